@@ -0,0 +1,293 @@
+package gnock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// readBody reads the whole request body and replaces it with an in-memory
+// copy so that later matchers and the responder can read it again.
+func readBody(req *http.Request) []byte {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		panic(fmt.Sprintf("Gnock could not read request body: %s", err))
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+func bodyMatcher(expected string) requestMatcher {
+	description := fmt.Sprintf("body %q", expected)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := string(readBody(req))
+			return actual == expected, fmt.Sprintf("expected %s, got %q", description, actual)
+		},
+	}
+}
+
+func bodyRegexpMatcher(re *regexp.Regexp) requestMatcher {
+	description := fmt.Sprintf("body =~ %s", re.String())
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := readBody(req)
+			return re.Match(actual), fmt.Sprintf("expected %s, got %q", description, actual)
+		},
+	}
+}
+
+func jsonBodyMatcher(expected interface{}) requestMatcher {
+	expectedJSON := jsonToString(expected)
+	expectedValue := mustDecodeJSON(expectedJSON)
+	description := fmt.Sprintf("JSON body %s", expectedJSON)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			body := readBody(req)
+			actual, err := decodeJSON(body)
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got invalid JSON %q", description, body)
+			}
+			return reflect.DeepEqual(expectedValue, actual), fmt.Sprintf("expected %s, got %s", description, body)
+		},
+	}
+}
+
+func jsonBodyContainsMatcher(subset interface{}) requestMatcher {
+	expectedJSON := jsonToString(subset)
+	expectedValue := mustDecodeJSON(expectedJSON)
+	description := fmt.Sprintf("JSON body contains %s", expectedJSON)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			body := readBody(req)
+			actual, err := decodeJSON(body)
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got invalid JSON %q", description, body)
+			}
+			if reason := jsonContains(jsonPath{}, expectedValue, actual); reason != "" {
+				return false, fmt.Sprintf("expected %s, but %s", description, reason)
+			}
+			return true, ""
+		},
+	}
+}
+
+func jsonPathMatcher(path jsonPath, value interface{}) requestMatcher {
+	expectedValue := normalizeJSON(value)
+	description := fmt.Sprintf("JSON path %s = %s", path, mustEncodeJSON(expectedValue))
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			body := readBody(req)
+			document, err := decodeJSON(body)
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got invalid JSON %q", description, body)
+			}
+			actual, found := path.lookup(document)
+			if !found {
+				return false, fmt.Sprintf("JSON path %s: not found", path)
+			}
+			if !reflect.DeepEqual(expectedValue, actual) {
+				return false, fmt.Sprintf("JSON path %s: expected %s, got %s", path, mustEncodeJSON(expectedValue), mustEncodeJSON(actual))
+			}
+			return true, ""
+		},
+	}
+}
+
+func formBodyMatcher(form url.Values) requestMatcher {
+	description := "form body " + describeQuery(form)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			body := readBody(req)
+			actual, err := url.ParseQuery(string(body))
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got invalid form %q", description, body)
+			}
+			return queryEquals(form, actual), fmt.Sprintf("expected %s, got %s", description, describeQuery(actual))
+		},
+	}
+}
+
+type multipartPart struct {
+	name        string
+	fileName    string
+	contentType string
+	content     string
+}
+
+func multipartFieldMatcher(name, value string) requestMatcher {
+	description := fmt.Sprintf("multipart field %s=%q", name, value)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			parts, err := readMultipart(req)
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got %s", description, err)
+			}
+			for _, part := range parts {
+				if part.name == name && part.fileName == "" {
+					if part.content == value {
+						return true, ""
+					}
+					return false, fmt.Sprintf("expected %s, got %q", description, part.content)
+				}
+			}
+			return false, fmt.Sprintf("expected %s, got no such field", description)
+		},
+	}
+}
+
+func multipartFileMatcher(name, fileName, contentType, content string) requestMatcher {
+	description := fmt.Sprintf("multipart file %s=%s", name, fileName)
+	if contentType != "" {
+		description += " (" + contentType + ")"
+	}
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			parts, err := readMultipart(req)
+			if err != nil {
+				return false, fmt.Sprintf("expected %s, got %s", description, err)
+			}
+			for _, part := range parts {
+				if part.name != name || part.fileName == "" {
+					continue
+				}
+				switch {
+				case part.fileName != fileName:
+					return false, fmt.Sprintf("expected %s, got file name %q", description, part.fileName)
+				case contentType != "" && part.contentType != contentType:
+					return false, fmt.Sprintf("expected %s, got content type %q", description, part.contentType)
+				case part.content != content:
+					return false, fmt.Sprintf("expected %s with content %q, got %q", description, content, part.content)
+				}
+				return true, ""
+			}
+			return false, fmt.Sprintf("expected %s, got no such file", description)
+		},
+	}
+}
+
+// readMultipart parses the buffered request body as multipart without
+// consuming it.
+func readMultipart(req *http.Request) ([]multipartPart, error) {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("non multipart content type %q", req.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(bytes.NewReader(readBody(req)), params["boundary"])
+	parts := make([]multipartPart, 0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart body (%s)", err)
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart body (%s)", err)
+		}
+		parts = append(parts, multipartPart{
+			name:        part.FormName(),
+			fileName:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+			content:     string(content),
+		})
+	}
+}
+
+// jsonContains returns a description of the first place where actual does
+// not contain expected or an empty string if it does.
+func jsonContains(path jsonPath, expected, actual interface{}) string {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actualObject, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("JSON path %s: expected an object, got %s", path, mustEncodeJSON(actual))
+		}
+		keys := make([]string, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			actualValue, found := actualObject[key]
+			if !found {
+				return fmt.Sprintf("JSON path %s: not found", path.key(key))
+			}
+			if reason := jsonContains(path.key(key), expected[key], actualValue); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	case []interface{}:
+		actualArray, ok := actual.([]interface{})
+		if !ok {
+			return fmt.Sprintf("JSON path %s: expected an array, got %s", path, mustEncodeJSON(actual))
+		}
+		if len(expected) != len(actualArray) {
+			return fmt.Sprintf("JSON path %s: expected %d elements, got %d", path, len(expected), len(actualArray))
+		}
+		for index := range expected {
+			if reason := jsonContains(path.index(index), expected[index], actualArray[index]); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return fmt.Sprintf("JSON path %s: expected %s, got %s", path, mustEncodeJSON(expected), mustEncodeJSON(actual))
+		}
+		return ""
+	}
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+func mustDecodeJSON(data string) interface{} {
+	value, err := decodeJSON([]byte(data))
+	if err != nil {
+		panic(fmt.Sprintf("expected valid JSON, got: %q (%s)", data, err))
+	}
+	return value
+}
+
+// normalizeJSON turns any Go value into the generic representation produced
+// by decoding JSON so that it can be compared with decoded request bodies.
+func normalizeJSON(value interface{}) interface{} {
+	return mustDecodeJSON(mustEncodeJSON(value))
+}
+
+func mustEncodeJSON(value interface{}) string {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		panic(err.Error())
+	}
+	return string(buf)
+}
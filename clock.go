@@ -0,0 +1,138 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for everything time dependent in Gnock: delays,
+// expiring interceptors, Date and Last-Modified headers and the time requests
+// were received. Set it on a scope with Scope.Clock.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a Timer that sends the current time on its channel
+	// once the duration has passed, like time.NewTimer.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event created by a Clock, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the default Clock that reads the time of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// FakeClock is a Clock whose time only moves when advanced, which makes tests
+// of delays, backoff and caching deterministic and fast.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.waiters = append(c.waiters, t)
+	return t
+}
+
+// Advance moves the time forward and wakes up everything waiting for a
+// duration that has now passed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := make([]*fakeTimer, 0, len(c.waiters))
+	for _, t := range c.waiters {
+		if t.deadline.After(c.now) {
+			waiting = append(waiting, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+// Waiters returns how many timers, e.g. of delayed responses, are waiting for
+// the time to be advanced. Timers of canceled requests are not waiting. Tests
+// that send requests from another goroutine can use it to advance the time
+// only once the request is waiting.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for index, waiting := range c.waiters {
+		if waiting == t {
+			c.waiters = append(c.waiters[:index:index], c.waiters[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ReceivedRequest is a request in the journal of a scope, see Scope.Received.
+type ReceivedRequest struct {
+	Request *http.Request
+	Time    time.Time
+}
+
+func (r ReceivedRequest) String() string {
+	return fmt.Sprintf("%s at %s", describeRequest(r.Request), r.Time.Format(time.RFC3339Nano))
+}
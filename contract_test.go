@@ -0,0 +1,236 @@
+package gnock_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gabrielf/gnock"
+)
+
+// These specs check that a Scope honours the http.RoundTripper contract so
+// that it can stand in for a real transport in an http.Client.
+var _ = Describe("http.RoundTripper contract", func() {
+	var client *http.Client
+
+	get := func(url string) *http.Response {
+		res, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	It("populates the response like a real transport", func() {
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Get("/").
+			Reply(404, "Not here")}
+
+		res := get("http://example.com/")
+		Expect(res.Status).To(Equal("404 Not Found"))
+		Expect(res.StatusCode).To(Equal(404))
+		Expect(res.Proto).To(Equal("HTTP/1.1"))
+		Expect(res.ProtoMajor).To(Equal(1))
+		Expect(res.ProtoMinor).To(Equal(1))
+		Expect(res.ContentLength).To(Equal(int64(len("Not here"))))
+		Expect(res.Header).NotTo(BeNil())
+		Expect(toString(res.Body)).To(Equal("Not here"))
+	})
+	It("reports an empty body as having no length", func() {
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Delete("/").
+			Reply(204, "").
+			Get("/").
+			ReplyJSON(200, "")}
+
+		req := newRequest("DELETE", "http://example.com/", nil)
+		res, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Status).To(Equal("204 No Content"))
+		Expect(res.ContentLength).To(BeZero())
+		Expect(toString(res.Body)).To(BeEmpty())
+
+		res = get("http://example.com/")
+		Expect(res.ContentLength).To(BeZero())
+	})
+	It("populates JSON responses", func() {
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Get("/").
+			ReplyJSON(200, `{"key":"value"}`)}
+
+		res := get("http://example.com/")
+		Expect(res.Status).To(Equal("200 OK"))
+		Expect(res.ContentLength).To(Equal(int64(len(`{"key":"value"}`))))
+		Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+	})
+	It("fills in the fields missing from custom responses", func() {
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Get("/empty").
+			Respond(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 204}, nil
+			}).
+			Get("/stream").
+			Respond(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("streamed"))}, nil
+			})}
+
+		res := get("http://example.com/empty")
+		Expect(res.Status).To(Equal("204 No Content"))
+		Expect(res.Proto).To(Equal("HTTP/1.1"))
+		Expect(res.Header).NotTo(BeNil())
+		Expect(res.Body).NotTo(BeNil())
+		Expect(res.ContentLength).To(BeZero())
+		Expect(res.Request.URL.String()).To(Equal("http://example.com/empty"))
+
+		res = get("http://example.com/stream")
+		Expect(res.ContentLength).To(Equal(int64(-1)))
+		Expect(toString(res.Body)).To(Equal("streamed"))
+	})
+	It("refers to the request given to RoundTrip", func() {
+		transport := gnock.Gnock("http://example.com").
+			Post("/").
+			Body("payload").
+			Reply(200, "OK")
+
+		req := newRequest("POST", "http://example.com/", strings.NewReader("payload"))
+		res := mustRoundTrip(transport, req)
+		Expect(res.Request).To(BeIdenticalTo(req))
+	})
+	It("closes the request body", func() {
+		body := &closeTracker{Reader: strings.NewReader("payload")}
+		transport := gnock.Gnock("http://example.com").
+			Post("/").
+			Body("payload").
+			Reply(200, "OK")
+
+		mustRoundTrip(transport, newRequest("POST", "http://example.com/", body))
+		Expect(body.closed).To(BeTrue())
+	})
+	It("closes the request body when replying with an error", func() {
+		body := &closeTracker{Reader: strings.NewReader("payload")}
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Post("/").
+			ReplyError(errors.New("connection refused"))}
+
+		_, err := client.Post("http://example.com/", "text/plain", body)
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		Expect(body.closed).To(BeTrue())
+	})
+	It("closes the request body when nothing matches", func() {
+		body := &closeTracker{Reader: strings.NewReader("payload")}
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			OnUnmatched(gnock.ErrorOnUnmatched)}
+
+		_, err := client.Post("http://example.com/", "text/plain", body)
+		Expect(err).To(HaveOccurred())
+		Expect(body.closed).To(BeTrue())
+	})
+	It("does not modify the request", func() {
+		transport := gnock.Gnock("http://example.com").
+			BasePath("/api").
+			HeadFromGet().
+			DefaultReplyHeaders(http.Header{"X-Default": {"yes"}}).
+			Get("/widgets").
+			Reply(200, "widgets")
+
+		req := newRequest("HEAD", "http://example.com/api/widgets", nil)
+		req.Header.Set("Accept", "text/plain")
+		mustRoundTrip(transport, req)
+
+		Expect(req.Method).To(Equal("HEAD"))
+		Expect(req.URL.String()).To(Equal("http://example.com/api/widgets"))
+		Expect(req.Header).To(Equal(http.Header{"Accept": {"text/plain"}}))
+	})
+	It("is safe for concurrent use", func() {
+		transport := gnock.Gnock("http://example.com").
+			Get("/").
+			Times(20).
+			Reply(200, "OK")
+		client = &http.Client{Transport: transport}
+
+		var wg sync.WaitGroup
+		for n := 0; n < 20; n++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				res := get("http://example.com/")
+				Expect(res.StatusCode).To(Equal(200))
+			}()
+		}
+		wg.Wait()
+
+		Expect(transport.Received()).To(HaveLen(20))
+		Expect(transport).To(gnock.BeDone())
+	})
+	It("stays usable after a matcher panics", func() {
+		transport := gnock.Gnock("http://example.com").
+			Get("/").
+			Match(gnock.MatcherFunc(func(req *http.Request) (bool, string) {
+				panic("kaboom")
+			})).
+			Reply(200, "OK")
+
+		Expect(func() {
+			transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+		}).To(PanicWith("kaboom"))
+
+		pending := make(chan []*gnock.Interceptor)
+		go func() {
+			pending <- transport.Pending()
+		}()
+		Eventually(pending).Should(Receive(HaveLen(1)))
+		Expect(transport.Received()).To(HaveLen(1))
+	})
+	It("follows redirects across interceptors", func() {
+		client = &http.Client{Transport: gnock.Gnock("http://example.com").
+			Get("/old").
+			Respond(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 301,
+					Header:     http.Header{"Location": {"/new"}},
+				}, nil
+			}).
+			Get("/new").
+			Reply(200, "moved")}
+
+		res := get("http://example.com/old")
+		Expect(res.StatusCode).To(Equal(200))
+		Expect(res.Request.URL.Path).To(Equal("/new"))
+		Expect(toString(res.Body)).To(Equal("moved"))
+	})
+	It("lets the client close response bodies of unread redirects", func() {
+		client = &http.Client{
+			Transport: gnock.Gnock("http://example.com").
+				Get("/old").
+				Respond(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 302,
+						Header:     http.Header{"Location": {"/new"}},
+					}, nil
+				}),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		res := get("http://example.com/old")
+		Expect(res.StatusCode).To(Equal(302))
+		Expect(res.Status).To(Equal("302 Found"))
+		Expect(res.Body.Close()).To(Succeed())
+	})
+})
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,64 @@
+package gnock
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+func (i *Interceptor) headerDelayOrDefault() time.Duration {
+	if i.headerDelayed {
+		return i.headerDelay
+	}
+	return i.scope.headerDelay
+}
+
+func (i *Interceptor) bodyDelayOrDefault() time.Duration {
+	if i.bodyDelayed {
+		return i.bodyDelay
+	}
+	return i.scope.bodyDelay
+}
+
+// delayBody makes the first read of the response body wait for the delay.
+func delayBody(req *http.Request, res *http.Response, clock Clock, d time.Duration) *http.Response {
+	if d > 0 && res.Body != http.NoBody {
+		res.Body = &delayedBody{ReadCloser: res.Body, ctx: req.Context(), clock: clock, delay: d}
+	}
+	return res
+}
+
+type delayedBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	clock  Clock
+	delay  time.Duration
+	waited bool
+}
+
+func (b *delayedBody) Read(p []byte) (int, error) {
+	if !b.waited {
+		if err := wait(b.ctx, b.clock, b.delay); err != nil {
+			return 0, err
+		}
+		b.waited = true
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// wait returns once the delay has passed on the clock or with the error of the
+// context if it is done first.
+func wait(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
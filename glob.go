@@ -0,0 +1,131 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Globs are a safer alternative to regexps for the common cases of matching
+// any subdomain or any path segment. In hosts "*" matches a single label, or
+// part of one, and "**" as the leftmost label matches one or more labels. In
+// paths "*" matches a single segment, or part of one, and "**" as a whole
+// segment matches any number of segments.
+
+func isGlob(pattern string) bool {
+	return strings.Contains(pattern, "*")
+}
+
+// hostGlobMatcher expects host to already be normalized.
+func hostGlobMatcher(host string) requestMatcher {
+	description := describeSchemeAndHost(host)
+	scheme, hostAndPort := splitSchemeAndHost(host)
+	schemePattern := regexp.QuoteMeta(scheme)
+	if scheme == "" {
+		schemePattern = `[^:/]+`
+	}
+	u := &url.URL{Host: hostAndPort}
+	hostPattern := hostGlobPattern(host, u.Hostname())
+	pattern := schemePattern + "://" + hostPattern + portPattern(u.Port())
+	if scheme == "" {
+		// Requests using a scheme with the port as default have it removed
+		for defaultScheme, defaultPort := range defaultPorts {
+			if u.Port() == defaultPort {
+				pattern += "|" + regexp.QuoteMeta(defaultScheme) + "://" + hostPattern
+			}
+		}
+	}
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := requestSchemeAndHost(req)
+			return re.MatchString(actual), fmt.Sprintf("host: expected to match %s, got %s", description, actual)
+		},
+		specificity: globSpecificity,
+	}
+}
+
+func pathGlobMatcher(path string) requestMatcher {
+	re := regexp.MustCompile("^" + pathGlobPattern(path) + "$")
+	return requestMatcher{
+		description: path,
+		matches: func(req *http.Request) (bool, string) {
+			actual := requestPath(req)
+			return re.MatchString(actual), fmt.Sprintf("path: expected to match %s, got %s", path, actual)
+		},
+		specificity: globSpecificity,
+	}
+}
+
+func hostGlobPattern(host, hostname string) string {
+	labels := strings.Split(hostname, ".")
+	patterns := make([]string, 0, len(labels))
+	for index, label := range labels {
+		switch {
+		case label == "**" && index == 0:
+			patterns = append(patterns, `[^.]+(?:\.[^.]+)*`)
+		case strings.Contains(label, "**"):
+			panic(fmt.Sprintf("ambiguous host glob %q, ** may only be used as the leftmost label", host))
+		case label == "*":
+			patterns = append(patterns, `[^.]+`)
+		default:
+			patterns = append(patterns, globSegmentPattern(label, `[^.]*`))
+		}
+	}
+	return strings.Join(patterns, `\.`)
+}
+
+func portPattern(port string) string {
+	if port == "" {
+		return ""
+	}
+	return regexp.QuoteMeta(":" + port)
+}
+
+func pathGlobPattern(path string) string {
+	if isPathTemplate(path) {
+		panic(fmt.Sprintf("ambiguous path %q, use either a glob or a template", path))
+	}
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("path glob must start with /, got: %q", path))
+	}
+	pattern := ""
+	previous := ""
+	for _, segment := range strings.Split(path[1:], "/") {
+		switch {
+		case segment == "**" && previous == "**":
+			panic(fmt.Sprintf("ambiguous path glob %q, ** may not follow **", path))
+		case segment == "**":
+			pattern += `(?:/[^/]+)*`
+		case strings.Contains(segment, "**"):
+			panic(fmt.Sprintf("ambiguous path glob %q, ** must be a whole segment", path))
+		case segment == "*":
+			pattern += `/[^/]+`
+		default:
+			pattern += "/" + globSegmentPattern(escapeGlobSegment(segment), `[^/]*`)
+		}
+		previous = segment
+	}
+	return pattern
+}
+
+// escapeGlobSegment escapes the literal parts of the segment the same way as
+// request paths so that they can be compared, see requestPath.
+func escapeGlobSegment(segment string) string {
+	parts := strings.Split(segment, "*")
+	for index, part := range parts {
+		parts[index] = strings.TrimPrefix(escapePath("/"+part), "/")
+	}
+	return strings.Join(parts, "*")
+}
+
+func globSegmentPattern(segment, wildcard string) string {
+	parts := strings.Split(segment, "*")
+	for index, part := range parts {
+		parts[index] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, wildcard)
+}
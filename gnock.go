@@ -4,15 +4,45 @@ package gnock
 import (
 	"net/http"
 	"regexp"
+	"testing"
 )
 
 // Gnock is one of the entry points for setting up mock responses. It takes
 // the host that Gnock will intercept and returns a Scope which is used to
-// setup the response(s) to send.
+// setup the response(s) to send. The host may contain glob wildcards, e.g.
+// "https://*.example.com" matches any direct subdomain of example.com, and a
+// base path, e.g. "https://example.com/api/v2", which interceptor paths are
+// relative to.
 func Gnock(host string) *Scope {
 	return NewScope(nil, host)
 }
 
+// New returns an empty root Scope tied to the test, add scopes for hosts to it
+// with Scope.Gnock and friends. When the test finishes it fails the test unless
+// all interceptors have been used and restores the default transport if it was
+// replaced. Unless another policy is set with Scope.OnUnmatched, requests
+// without match fail the test using t.Errorf and make RoundTrip return an
+// error instead of panicking, which could otherwise crash a goroutine that the
+// test does not own.
+func New(t testing.TB) *Scope {
+	s := &Scope{
+		hostMatcher:    noHostMatcher(),
+		interceptors:   make([]*Interceptor, 0),
+		defaultHeaders: make(http.Header, 0),
+		t:              t,
+	}
+	t.Cleanup(s.verify)
+	return s
+}
+
+// GnockHosts is like Gnock but the returned Scope intercepts requests to any
+// of the given hosts, e.g. a primary and a failover endpoint. A host without
+// scheme, e.g. "//example.com", intercepts requests using any scheme which
+// works with Gnock too.
+func GnockHosts(hosts ...string) *Scope {
+	return NewHostsScope(nil, hosts)
+}
+
 // GnockRegexp is another entry points for setting up mock responses. The
 // difference from the Gnock(…) function is that the host will be compiled
 // as a normal go regexp to enable matching a broader set of hosts. If you
@@ -5,13 +5,23 @@ import (
 	. "github.com/onsi/gomega"
 
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"testing"
+	"time"
 
 	"github.com/gabrielf/gnock"
 )
@@ -33,13 +43,10 @@ var _ = Describe("gnock", func() {
 		Expect(res.StatusCode).To(Equal(200))
 		Expect(toString(res.Body)).To(Equal("Hello, World!"))
 	})
-	It("panics if host is invalid, includes a path or a query string to avoid ambiguous usage", func() {
+	It("panics if host is invalid or includes a query string to avoid ambiguous usage", func() {
 		Expect(func() {
 			gnock.Gnock(":")
 		}).To(Panic())
-		Expect(func() {
-			gnock.Gnock("http://example.com/with/path")
-		}).To(Panic())
 		Expect(func() {
 			gnock.Gnock("http://example.com/?key=value")
 		}).To(Panic())
@@ -157,6 +164,957 @@ var _ = Describe("gnock", func() {
 		res = mustRoundTrip(transport, newRequest("GET", "http://other.com/bar", nil))
 		Expect(res.StatusCode).To(Equal(200))
 	})
+	Describe("Query matching", func() {
+		It("tells requests apart by their exact query", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/search").
+				Query(url.Values{"page": {"2"}}).
+				Reply(200, "page 2").
+				Get("/search").
+				Query(url.Values{"page": {"1"}}).
+				Reply(200, "page 1")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/search?page=1", nil))
+			Expect(toString(res.Body)).To(Equal("page 1"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/search?page=2", nil))
+			Expect(toString(res.Body)).To(Equal("page 2"))
+		})
+		It("does not match extra parameters with an exact query", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/search").
+				Query(url.Values{"q": {"a"}}).
+				Reply(200, "OK")
+
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/search?q=a&page=1", nil))
+			}).To(Panic())
+		})
+		It("can match a subset of the query", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/search").
+				QueryContains(url.Values{"q": {"a"}}).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/search?q=a&page=1", nil))
+		})
+		It("can match query parameters using regexps", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/search").
+				QueryRegexp(map[string]string{"page": "^[0-9]+$"}).
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/search?page=1", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/search?page=last", nil))
+			}).To(Panic())
+		})
+		It("can match the query using a predicate", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/search").
+				QueryFunc(func(query url.Values) bool {
+					return query.Get("q") != ""
+				}).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/search?q=a", nil))
+		})
+		It("describes how to add the query on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com")
+
+			req := newRequest("GET", "http://example.com/search?q=a&page=1", nil)
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring(`gnock.Gnock("http://example.com").
+	Get("/search").
+	Query(url.Values{"page": {"1"}, "q": {"a"}}).
+	Reply(200, "OK")`))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(req)
+		})
+	})
+	Describe("Header matching", func() {
+		It("matches requests carrying the header value", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				MatchHeader("Accept", "application/json").
+				Reply(200, "OK")
+
+			req := newRequest("GET", "http://example.com/", nil)
+			Expect(func() {
+				transport.RoundTrip(req)
+			}).To(Panic())
+
+			req.Header.Set("Accept", "application/json")
+			mustRoundTrip(transport, req)
+		})
+		It("can match headers using regexps", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				MatchHeaderRegexp("Authorization", "^Bearer .+$").
+				Reply(200, "OK")
+
+			req := newRequest("GET", "http://example.com/", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			mustRoundTrip(transport, req)
+		})
+		It("can require a header to be absent", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				MatchHeaderAbsent("Cookie").
+				Reply(200, "OK")
+
+			req := newRequest("GET", "http://example.com/", nil)
+			req.Header.Set("Cookie", "session=1")
+			Expect(func() {
+				transport.RoundTrip(req)
+			}).To(Panic())
+
+			req.Header.Del("Cookie")
+			mustRoundTrip(transport, req)
+		})
+		It("applies scope headers to every interceptor in the scope", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				MatchHeader("X-Trace-Id", "abc").
+				Get("/a").
+				Reply(200, "a").
+				Get("/b").
+				Reply(200, "b")
+
+			req := newRequest("GET", "http://example.com/a", nil)
+			req.Header.Set("X-Trace-Id", "abc")
+			mustRoundTrip(transport, req)
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET http://example.com/b [header X-Trace-Id: abc]"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "http://example.com/b", nil))
+		})
+	})
+	Describe("Body matching", func() {
+		It("tells requests apart by their exact body", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				Body("b").
+				Reply(200, "b").
+				Post("/").
+				Body("a").
+				Reply(200, "a")
+
+			res := mustRoundTrip(transport, newRequest("POST", "http://example.com/", bytes.NewBufferString("a")))
+			Expect(toString(res.Body)).To(Equal("a"))
+		})
+		It("can match the body using a regexp", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				BodyRegexp("^name=.+$").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("POST", "http://example.com/", bytes.NewBufferString("name=gnock")))
+		})
+		It("matches JSON bodies regardless of key order and whitespace", func() {
+			type Widget struct {
+				Key  string `json:"key"`
+				Size int    `json:"size"`
+			}
+
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				JSONBody(Widget{Key: "value", Size: 1}).
+				Reply(200, "struct").
+				Post("/").
+				JSONBody(`{"size": 2, "key": "value"}`).
+				Reply(200, "string")
+
+			res := mustRoundTrip(transport, newRequest("POST", "http://example.com/", bytes.NewBufferString(`{"key":"value","size":2}`)))
+			Expect(toString(res.Body)).To(Equal("string"))
+
+			res = mustRoundTrip(transport, newRequest("POST", "http://example.com/", bytes.NewBufferString(` { "size":1, "key":"value" } `)))
+			Expect(toString(res.Body)).To(Equal("struct"))
+		})
+		It("lets the responder read the matched body", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				Body("echo").
+				Respond(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						Request:    req,
+						StatusCode: 200,
+						Body:       req.Body,
+					}, nil
+				})
+
+			res := mustRoundTrip(transport, newRequest("POST", "http://example.com/", bytes.NewBufferString("echo")))
+			Expect(toString(res.Body)).To(Equal("echo"))
+		})
+	})
+	Describe("Partial JSON body matching", func() {
+		body := `{"id":"4f1c","createdAt":"2015-09-10T12:00:00Z","items":[{"sku":"A-1","quantity":2}]}`
+
+		It("matches a subset of the JSON body", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/orders").
+				JSONBodyContains(map[string]interface{}{
+					"items": []interface{}{map[string]interface{}{"sku": "A-1"}},
+				}).
+				Reply(201, "")
+
+			mustRoundTrip(transport, newRequest("POST", "http://example.com/orders", bytes.NewBufferString(body)))
+		})
+		It("matches values found using JSONPath expressions", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/orders").
+				JSONPath("$.items[0].sku", "A-1").
+				JSONPath("$.items[0]['quantity']", 2).
+				Reply(201, "")
+
+			mustRoundTrip(transport, newRequest("POST", "http://example.com/orders", bytes.NewBufferString(body)))
+		})
+		It("panics on invalid JSONPath expressions", func() {
+			Expect(func() {
+				gnock.Gnock("http://example.com").Post("/").JSONPath("items[0]", "A-1")
+			}).To(Panic())
+		})
+		It("explains which JSON path failed on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				Post("/orders").
+				JSONPath("$.items[0].sku", "B-2").
+				Reply(201, "").
+				Post("/orders").
+				JSONBodyContains(`{"items":[{"quantity":3}]}`).
+				Reply(201, "")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring(`JSON path $.items[0].sku: expected "B-2", got "A-1"`))
+					Expect(err).To(ContainSubstring(`JSON path $.items[0].quantity: expected 3, got 2`))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("POST", "http://example.com/orders", bytes.NewBufferString(body)))
+		})
+	})
+	Describe("Form body matching", func() {
+		It("matches URL encoded forms", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/login").
+				FormBody(url.Values{"user": {"gnock"}, "password": {"secret"}}).
+				Reply(200, "OK")
+
+			req := newRequest("POST", "http://example.com/login", bytes.NewBufferString("password=secret&user=gnock"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			mustRoundTrip(transport, req)
+		})
+		It("matches multipart fields and files", func() {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			Expect(writer.WriteField("title", "Report")).To(Succeed())
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="upload"; filename="report.csv"`)
+			header.Set("Content-Type", "text/csv")
+			part, err := writer.CreatePart(header)
+			Expect(err).ToNot(HaveOccurred())
+			part.Write([]byte("a,b\n1,2\n"))
+			Expect(writer.Close()).To(Succeed())
+
+			transport := gnock.Gnock("http://example.com").
+				Post("/uploads").
+				MultipartField("title", "Report").
+				MultipartFile("upload", "report.csv", "text/csv", "a,b\n1,2\n").
+				Respond(func(req *http.Request) (*http.Response, error) {
+					Expect(req.ParseMultipartForm(1024)).To(Succeed())
+					Expect(req.FormValue("title")).To(Equal("Report"))
+					return &http.Response{StatusCode: 201}, nil
+				})
+
+			req := newRequest("POST", "http://example.com/uploads", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			res := mustRoundTrip(transport, req)
+			Expect(res.StatusCode).To(Equal(201))
+		})
+		It("explains multipart mismatches on panic", func(done Done) {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, err := writer.CreateFormFile("upload", "report.txt")
+			Expect(err).ToNot(HaveOccurred())
+			part.Write([]byte("content"))
+			Expect(writer.Close()).To(Succeed())
+
+			transport := gnock.Gnock("http://example.com").
+				Post("/uploads").
+				MultipartFile("upload", "report.csv", "", "content").
+				Reply(201, "")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring(`got file name "report.txt"`))
+					close(done)
+				}
+			}()
+
+			req := newRequest("POST", "http://example.com/uploads", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			transport.RoundTrip(req)
+		})
+	})
+	Describe("Custom matchers", func() {
+		hasCookie := gnock.MatcherFunc(func(req *http.Request) (bool, string) {
+			if _, err := req.Cookie("session"); err != nil {
+				return false, "no session cookie"
+			}
+			return true, ""
+		})
+
+		It("intercepts requests matched by custom matchers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Match(hasCookie).
+				Reply(200, "OK")
+
+			req := newRequest("GET", "http://example.com/", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: "1"})
+			mustRoundTrip(transport, req)
+		})
+		It("applies scope matchers to every interceptor in the scope", func() {
+			transport := gnock.Gnock("http://example.com").
+				Match(hasCookie).
+				Get("/").
+				Reply(200, "OK")
+
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+			}).To(Panic())
+		})
+		It("reports the reason of custom matchers on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Match(hasCookie).
+				Reply(200, "OK").
+				Get("/other").
+				Reply(200, "OK")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("no match: no session cookie"))
+					Expect(err).To(ContainSubstring("no match: path: expected /other, got /"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+		})
+	})
+	Describe("Gomega integration", func() {
+		It("matches request fields using Gomega matchers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				MatchWith(gnock.PathField, HavePrefix("/")).
+				MatchWith(gnock.QueryField, HaveKey("q")).
+				MatchWith(gnock.HeaderField("Accept"), ContainSubstring("json")).
+				MatchWith(gnock.BodyField, MatchJSON(`{"key":"value"}`)).
+				Reply(200, "OK")
+
+			req := newRequest("POST", "http://example.com/?q=a", bytes.NewBufferString(`{ "key": "value" }`))
+			req.Header.Set("Accept", "application/json")
+			mustRoundTrip(transport, req)
+		})
+		It("reports Gomega failure messages on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				MatchWith(gnock.BodyField, ContainSubstring("needle")).
+				Reply(200, "OK")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("no match: body: Expected"))
+					Expect(err).To(ContainSubstring("to contain substring"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("POST", "http://example.com/", bytes.NewBufferString("haystack")))
+		})
+		It("verifies scopes using Gomega matchers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			Expect(transport).ToNot(gnock.BeDone())
+			Expect(transport).ToNot(gnock.HaveReceivedRequest("GET", "http://example.com/"))
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+
+			Expect(transport).To(gnock.BeDone())
+			Expect(transport).To(gnock.HaveReceivedRequest("GET", "http://example.com/"))
+		})
+		It("normalizes URLs of received requests", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/a%2Fb").
+				Query(url.Values{"x": {"1"}, "y": {"2"}}).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "HTTP://Example.com:80/a%2fb?y=2&x=1", nil))
+
+			Expect(transport).To(gnock.HaveReceivedRequest("GET", "http://example.com/a%2Fb?x=1&y=2"))
+			Expect(transport).ToNot(gnock.HaveReceivedRequest("GET", "http://example.com/a/b?x=1&y=2"))
+		})
+	})
+	Describe("Path templates", func() {
+		It("passes captured parameters to the responder", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/widgets/{id:int}/parts/{name}").
+				Times(2).
+				RespondWithParams(func(req *http.Request, params gnock.Params) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf("widget %d part %s", params.Int("id")*10, params["name"]))),
+					}, nil
+				})
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/1/parts/bolt", nil))
+			Expect(toString(res.Body)).To(Equal("widget 10 part bolt"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/2/parts/nut", nil))
+			Expect(toString(res.Body)).To(Equal("widget 20 part nut"))
+		})
+		It("only matches parameters of the declared type", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/widgets/{id:int}").
+				Reply(200, "OK")
+
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/widgets/abc", nil))
+			}).To(Panic())
+		})
+		It("does not match integers out of range for an int", func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Get("/widgets/{id:int}").
+				RespondWithParams(func(req *http.Request, params gnock.Params) (*http.Response, error) {
+					return &http.Response{StatusCode: 200 + params.Int("id")}, nil
+				})
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/widgets/99999999999999999999999", nil))
+			Expect(err).To(MatchError(ContainSubstring("path: expected /widgets/{id:int}")))
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/-1", nil))
+			Expect(res.StatusCode).To(Equal(199))
+		})
+		It("captures parameters when ignoring a trailing slash", func() {
+			transport := gnock.Gnock("http://example.com").
+				IgnoreTrailingSlash().
+				Get("/widgets/{id}").
+				ReplyTemplate(200, "widget {{.Params.id}}")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/7/", nil))
+			Expect(toString(res.Body)).To(Equal("widget 7"))
+		})
+		It("panics on invalid templates", func() {
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/widgets/{id")
+			}).To(Panic())
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/widgets/{id:float}")
+			}).To(Panic())
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/{id}/{id}")
+			}).To(Panic())
+		})
+		It("describes captured values", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				Get("/widgets/{id:int}").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/7", nil))
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET http://example.com/widgets/{id:int} (captured id=7)"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "http://example.com/widgets/8", nil))
+		})
+	})
+	Describe("Globs", func() {
+		It("matches hosts using wildcards", func() {
+			transport := gnock.Gnock("https://*.example.com").
+				Get("/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "https://api.example.com/", nil))
+			mustRoundTrip(transport, newRequest("GET", "https://www.example.com/", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "https://a.b.example.com/", nil))
+			}).To(Panic())
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "https://wwwxexample.com/", nil))
+			}).To(Panic())
+		})
+		It("matches any number of leading labels using **", func() {
+			transport := gnock.Gnock("https://**.example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "https://a.b.example.com/", nil))
+		})
+		It("matches paths using wildcards", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/users/*/posts/**").
+				Times(3).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/users/1/posts", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/users/1/posts/2", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/users/1/posts/2/comments", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/users/1/2/posts", nil))
+			}).To(Panic())
+		})
+		It("panics on ambiguous patterns", func() {
+			Expect(func() {
+				gnock.Gnock("https://api.**.example.com")
+			}).To(Panic())
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/users/**/**")
+			}).To(Panic())
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/users/a**")
+			}).To(Panic())
+			Expect(func() {
+				gnock.Gnock("http://example.com").Get("/users/{id}/*")
+			}).To(Panic())
+		})
+	})
+	Describe("Base paths", func() {
+		It("makes interceptor paths relative to the base path of the host", func() {
+			transport := gnock.Gnock("https://api.example.com/api/v2").
+				Get("/widgets").
+				Reply(200, "widgets")
+
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "https://api.example.com/widgets", nil))
+			}).To(Panic())
+
+			res := mustRoundTrip(transport, newRequest("GET", "https://api.example.com/api/v2/widgets", nil))
+			Expect(toString(res.Body)).To(Equal("widgets"))
+		})
+		It("can set the base path on the scope", func() {
+			transport := gnock.GnockRegexp("^https://.*\\.example\\.com$").
+				BasePath("/api/v2/").
+				Get("/widgets/{id:int}").
+				RespondWithParams(func(req *http.Request, params gnock.Params) (*http.Response, error) {
+					return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(params["id"]))}, nil
+				})
+
+			res := mustRoundTrip(transport, newRequest("GET", "https://api.example.com/api/v2/widgets/3", nil))
+			Expect(toString(res.Body)).To(Equal("3"))
+		})
+		It("describes how to add the missing interceptor relative to the closest scope", func(done Done) {
+			transport := gnock.Gnock("https://api.example.com").
+				Get("/health").
+				Reply(200, "OK").
+				Gnock("https://api.example.com/api/v2").
+				Get("/widgets").
+				Reply(200, "widgets")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET https://api.example.com/api/v2/widgets"))
+					Expect(err).To(ContainSubstring(`gnock.Gnock("https://api.example.com/api/v2").
+	Get("/gadgets").
+	Reply(200, "OK")`))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "https://api.example.com/api/v2/gadgets", nil))
+		})
+	})
+	Describe("URL normalization", func() {
+		It("matches hosts regardless of case and default ports", func() {
+			transport := gnock.Gnock("HTTP://Example.com:80").
+				Get("/").
+				Times(3).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://EXAMPLE.com:80/", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://example.com:80/", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com:8080/", nil))
+			}).To(Panic())
+		})
+		It("matches internationalized domain names in punycode", func() {
+			transport := gnock.Gnock("https://bücher.example").
+				Get("/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "https://xn--bcher-kva.example/", nil))
+			mustRoundTrip(transport, newRequest("GET", "https://BÜCHER.example/", nil))
+		})
+		It("tells encoded slashes apart from path separators", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/files/a%2Fb").
+				Reply(200, "encoded").
+				Get("/files/a/b").
+				Reply(200, "separated").
+				Get("/files/a b").
+				Reply(200, "space")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/files/a/b", nil))
+			Expect(toString(res.Body)).To(Equal("separated"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/files/a%2fb", nil))
+			Expect(toString(res.Body)).To(Equal("encoded"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/files/a%20b", nil))
+			Expect(toString(res.Body)).To(Equal("space"))
+		})
+		It("matches encoded slashes within a segment using globs and templates", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/glob/*").
+				Reply(200, "glob").
+				Get("/template/{name}").
+				ReplyTemplate(200, "template {{.Params.name}}").
+				Get("/field").
+				MatchWith(gnock.PathField, Equal("/field")).
+				Reply(200, "field")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/glob/b%2Fc", nil))
+			Expect(toString(res.Body)).To(Equal("glob"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/template/a%2fb", nil))
+			Expect(toString(res.Body)).To(Equal("template a/b"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/field", nil))
+			Expect(toString(res.Body)).To(Equal("field"))
+		})
+		It("matches regexps against the decoded path", func() {
+			transport := gnock.Gnock("http://example.com").
+				GetRegexp("^/files/a b$").
+				Reply(200, "space").
+				GetRegexp("^/bücher/[0-9]+$").
+				Reply(200, "unicode").
+				GetRegexp("^/slash/a/b$").
+				Reply(200, "slash")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/files/a%20b", nil))
+			Expect(toString(res.Body)).To(Equal("space"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/b%C3%BCcher/42", nil))
+			Expect(toString(res.Body)).To(Equal("unicode"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/slash/a%2Fb", nil))
+			Expect(toString(res.Body)).To(Equal("slash"))
+		})
+		It("describes the escaped path in mismatch reasons", func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Get("/files/*/c").
+				Reply(200, "OK")
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/files/a%2Fb", nil))
+			Expect(err).To(MatchError(ContainSubstring("got /files/a%2Fb")))
+			Expect(err).To(MatchError(ContainSubstring(`Get("/files/a%2Fb")`)))
+		})
+		It("can ignore trailing slashes", func() {
+			transport := gnock.Gnock("http://example.com").
+				IgnoreTrailingSlash().
+				Get("/widgets").
+				Reply(200, "OK").
+				Get("/gadgets/").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/gadgets", nil))
+		})
+		It("describes normalized URLs on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET https://other.com/a%2Fb"))
+					Expect(err).To(ContainSubstring(`gnock.Gnock("https://other.com").
+	Get("/a%2Fb").`))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "HTTPS://Other.com:443/a%2fb", nil))
+		})
+	})
+	Describe("Scheme agnostic and multi host scopes", func() {
+		It("matches default ports of scheme relative hosts", func() {
+			transport := gnock.Gnock("//example.com:443").
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Get("/").
+				Reply(200, "exact").
+				Gnock("//*.example.com:80").
+				Get("/").
+				Reply(200, "glob")
+
+			res := mustRoundTrip(transport, newRequest("GET", "https://example.com:443/", nil))
+			Expect(toString(res.Body)).To(Equal("exact"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://api.example.com:80/", nil))
+			Expect(toString(res.Body)).To(Equal("glob"))
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+			Expect(err).To(HaveOccurred())
+		})
+		It("matches any scheme when the host has none", func() {
+			transport := gnock.Gnock("//example.com").
+				Get("/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("GET", "https://example.com/", nil))
+		})
+		It("matches any of several hosts", func() {
+			transport := gnock.GnockHosts("https://primary.example.com/api", "https://failover.example.com/api").
+				Get("/widgets").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "https://primary.example.com/api/widgets", nil))
+			mustRoundTrip(transport, newRequest("GET", "https://failover.example.com/api/widgets", nil))
+		})
+		It("panics if the hosts have different base paths", func() {
+			Expect(func() {
+				gnock.GnockHosts("https://primary.example.com/api", "https://failover.example.com")
+			}).To(Panic())
+		})
+		It("lists all hosts when describing interceptors", func(done Done) {
+			transport := gnock.GnockHosts("https://primary.example.com", "//failover.example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET {https://primary.example.com, *://failover.example.com}/"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "https://other.example.com/", nil))
+		})
+	})
+	Describe("HTTP methods", func() {
+		It("fakes responses for PATCH, HEAD, CONNECT and TRACE requests", func() {
+			transport := gnock.Gnock("http://example.com").
+				Patch("/").
+				Reply(200, "patch").
+				Headf("/%s", "path").
+				Reply(200, "").
+				ConnectRegexp("^/tunnel/[0-9]+$").
+				Reply(200, "connect").
+				Trace("/").
+				Reply(200, "trace")
+
+			res := mustRoundTrip(transport, newRequest("PATCH", "http://example.com/", nil))
+			Expect(toString(res.Body)).To(Equal("patch"))
+			mustRoundTrip(transport, newRequest("HEAD", "http://example.com/path", nil))
+			res = mustRoundTrip(transport, newRequest("CONNECT", "http://example.com/tunnel/1", nil))
+			Expect(toString(res.Body)).To(Equal("connect"))
+			res = mustRoundTrip(transport, newRequest("TRACE", "http://example.com/", nil))
+			Expect(toString(res.Body)).To(Equal("trace"))
+		})
+		It("can intercept any method", func() {
+			transport := gnock.Gnock("http://example.com").
+				Any("/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("PROPFIND", "http://example.com/", nil))
+		})
+		It("can intercept several methods", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				Methods([]string{"PUT", "PATCH"}, "/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("PUT", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("PATCH", "http://example.com/", nil))
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("PUT|PATCH http://example.com/"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("POST", "http://example.com/", nil))
+		})
+		It("upper cases the given methods", func() {
+			transport := gnock.Gnock("http://example.com").
+				Methods([]string{"get", "Post"}, "/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("POST", "http://example.com/", nil))
+		})
+		It("panics on an empty list of methods as it would never match", func() {
+			Expect(func() {
+				gnock.Gnock("http://example.com").Methods([]string{}, "/")
+			}).To(Panic())
+		})
+		It("suggests helpers that exist for every standard method", func() {
+			helperRegexp := regexp.MustCompile(`\n\t([A-Za-z]+)\(`)
+			for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE", "get"} {
+				func() {
+					defer func() {
+						err := recover()
+						Expect(err).To(BeAssignableToTypeOf(""))
+						helper := helperRegexp.FindStringSubmatch(err.(string))[1]
+						Expect(reflect.ValueOf(&gnock.Scope{}).MethodByName(helper).IsValid()).To(BeTrue(), helper)
+						if method == "get" {
+							Expect(helper).To(Equal("Intercept"))
+						}
+					}()
+
+					gnock.Gnock("http://example.com").RoundTrip(newRequest(method, "http://other.com/", nil))
+				}()
+			}
+		})
+	})
+	Describe("HEAD requests served from GET interceptors", func() {
+		It("is opt-in", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Reply(200, "Hello, World!")
+
+			Expect(func() {
+				transport.RoundTrip(newRequest("HEAD", "http://example.com/", nil))
+			}).To(Panic())
+		})
+		It("strips the body but keeps headers and Content-Length", func() {
+			transport := gnock.Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				ReplyJSON(200, `{"key":"value"}`)
+
+			res := mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			Expect(res.StatusCode).To(Equal(200))
+			Expect(res.Request.Method).To(Equal("HEAD"))
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(res.Header.Get("Content-Length")).To(Equal("15"))
+			Expect(res.ContentLength).To(Equal(int64(15)))
+			Expect(toString(res.Body)).To(BeEmpty())
+		})
+		It("counts HEAD requests against the times of the GET interceptor", func() {
+			transport := gnock.Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+			}).To(Panic())
+		})
+		It("can give HEAD requests a separate budget", func() {
+			transport := gnock.Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				HeadTimes(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			Expect(func() {
+				transport.RoundTrip(newRequest("HEAD", "http://example.com/", nil))
+			}).To(Panic())
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(toString(res.Body)).To(Equal("OK"))
+		})
+		It("prefers HEAD interceptors", func() {
+			transport := gnock.Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				Reply(200, "OK").
+				Head("/").
+				Reply(204, "")
+
+			res := mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			Expect(res.StatusCode).To(Equal(204))
+		})
+	})
+	Describe("Choosing among matching interceptors", func() {
+		It("uses the first registered interceptor by default", func() {
+			transport := gnock.Gnock("http://example.com").
+				GetRegexp("^/widgets/.*$").
+				Reply(200, "regexp").
+				Get("/widgets/1").
+				Reply(200, "exact")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/1", nil))
+			Expect(toString(res.Body)).To(Equal("regexp"))
+		})
+		It("prefers interceptors with higher priority", func() {
+			transport := gnock.Gnock("http://example.com").
+				GetRegexp("^/widgets/.*$").
+				Reply(200, "regexp").
+				Get("/widgets/1").
+				Priority(1).
+				Reply(200, "exact")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/widgets/1", nil))
+			Expect(toString(res.Body)).To(Equal("exact"))
+		})
+		It("can prefer the most specific interceptor", func() {
+			transport := gnock.GnockRegexp(".*").
+				Get("/widgets/1").
+				Reply(200, "regexp host").
+				Gnock("http://example.com").
+				MatchStrategy(gnock.MostSpecific).
+				GetRegexp("^/widgets/.*$").
+				Reply(200, "regexp path").
+				Get("/widgets/{id}").
+				Reply(200, "template path").
+				Get("/widgets/1").
+				Reply(200, "exact path").
+				Get("/widgets/1").
+				MatchHeader("Accept", "application/json").
+				Reply(200, "exact path with header")
+
+			req := newRequest("GET", "http://example.com/widgets/1", nil)
+			req.Header.Set("Accept", "application/json")
+			for _, expected := range []string{"exact path with header", "exact path", "template path", "regexp path", "regexp host"} {
+				res := mustRoundTrip(transport, req)
+				Expect(toString(res.Body)).To(Equal(expected))
+			}
+		})
+		It("reports the strategy on panic", func(done Done) {
+			transport := gnock.Gnock("http://example.com").
+				MatchStrategy(gnock.MostSpecific)
+
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("Match strategy: most specific"))
+					close(done)
+				}
+			}()
+
+			transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+		})
+	})
 	It("panics when no match is found for the request", func() {
 		transport := gnock.Gnock("http://example.com")
 
@@ -281,6 +1239,64 @@ var _ = Describe("gnock", func() {
 
 		mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
 	})
+	Describe("Verifying that all interceptors have been used", func() {
+		var transport *gnock.Scope
+
+		BeforeEach(func() {
+			transport = gnock.Gnock("http://example.com").
+				Get("/a").
+				Reply(200, "a").
+				Get("/b").
+				Times(2).
+				Reply(200, "b").
+				Gnock("http://other.com").
+				Get("/c").
+				Reply(200, "c")
+		})
+		It("checks the whole hierarchy with IsDone()", func() {
+			mustRoundTrip(transport, newRequest("GET", "http://other.com/c", nil))
+
+			Expect(transport.IsDone).To(Panic())
+		})
+		It("lists pending interceptors", func() {
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/b", nil))
+
+			pending := transport.Pending()
+			Expect(pending).To(HaveLen(3))
+			Expect(pending[0].String()).To(Equal("GET http://example.com/a\n"))
+			Expect(pending[1].String()).To(Equal("GET http://example.com/b\n"))
+			Expect(pending[2].String()).To(Equal("GET http://other.com/c\n"))
+		})
+		It("describes every pending interceptor in an error", func() {
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/a", nil))
+
+			err := transport.Err()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("GET http://example.com/b\nGET http://other.com/c\n"))
+			Expect(err.Error()).ToNot(ContainSubstring("/a"))
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/b", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/b", nil))
+			mustRoundTrip(transport, newRequest("GET", "http://other.com/c", nil))
+			Expect(transport.Err()).ToNot(HaveOccurred())
+			Expect(transport.Pending()).To(BeEmpty())
+		})
+		It("verifies the separate budget of HEAD requests", func() {
+			transport := gnock.Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				HeadTimes(1).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(transport.Pending()).To(HaveLen(1))
+			Expect(transport.IsDone).To(Panic())
+
+			mustRoundTrip(transport, newRequest("HEAD", "http://example.com/", nil))
+			Expect(transport.Pending()).To(BeEmpty())
+			Expect(transport.Err()).ToNot(HaveOccurred())
+		})
+	})
 	It("can fake requests to multiple domains", func() {
 		transport := gnock.Gnock("http://example.com").
 			Get("/").
@@ -297,6 +1313,205 @@ var _ = Describe("gnock", func() {
 		Expect(res.StatusCode).To(Equal(200))
 		Expect(toString(res.Body)).To(Equal("other"))
 	})
+	Describe("Sibling scopes", func() {
+		var root *gnock.Scope
+
+		BeforeEach(func() {
+			root = gnock.Gnock("http://example.com")
+			root.Gnock("http://first.com").
+				Get("/").
+				Reply(200, "first")
+			root.Gnock("http://second.com").
+				Get("/").
+				Reply(200, "second").
+				Gnock("http://nested.com").
+				Get("/").
+				Reply(200, "nested")
+		})
+		It("keeps every sibling scope attached to the same scope", func() {
+			res := mustRoundTrip(root, newRequest("GET", "http://first.com/", nil))
+			Expect(toString(res.Body)).To(Equal("first"))
+
+			res = mustRoundTrip(root, newRequest("GET", "http://second.com/", nil))
+			Expect(toString(res.Body)).To(Equal("second"))
+
+			res = mustRoundTrip(root, newRequest("GET", "http://nested.com/", nil))
+			Expect(toString(res.Body)).To(Equal("nested"))
+		})
+		It("describes the interceptors of every sibling on panic", func(done Done) {
+			defer func() {
+				if err := recover(); err != nil {
+					Expect(err).To(ContainSubstring("GET http://first.com/"))
+					Expect(err).To(ContainSubstring("GET http://second.com/"))
+					Expect(err).To(ContainSubstring("GET http://nested.com/"))
+					close(done)
+				}
+			}()
+
+			root.RoundTrip(newRequest("GET", "http://other.com/", nil))
+		})
+		It("verifies every sibling with IsDone()", func() {
+			mustRoundTrip(root, newRequest("GET", "http://first.com/", nil))
+			mustRoundTrip(root, newRequest("GET", "http://second.com/", nil))
+
+			Expect(root.IsDone).To(Panic())
+		})
+	})
+	Describe("testing.TB integration", func() {
+		var t *fakeT
+
+		BeforeEach(func() {
+			t = &fakeT{}
+		})
+		It("fails the test on cleanup if interceptors are unused", func() {
+			gnock.New(t).
+				Gnock("http://example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			t.cleanup()
+			Expect(t.errors).To(HaveLen(1))
+			Expect(t.errors[0]).To(ContainSubstring("GET http://example.com/"))
+		})
+		It("passes when all interceptors are used", func() {
+			transport := gnock.New(t).
+				Gnock("http://example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+
+			t.cleanup()
+			Expect(t.errors).To(BeEmpty())
+		})
+		It("fails the test on cleanup if a separate HEAD budget is unused", func() {
+			transport := gnock.New(t).
+				Gnock("http://example.com").
+				HeadFromGet().
+				Get("/").
+				HeadTimes(1).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+
+			t.cleanup()
+			Expect(t.errors).To(HaveLen(1))
+			Expect(t.errors[0]).To(ContainSubstring("GET http://example.com/"))
+		})
+		It("reports unmatched requests as test errors instead of panicking", func() {
+			transport := gnock.New(t).
+				Gnock("http://example.com").
+				Get("/").
+				Reply(200, "OK")
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/other", nil))
+			Expect(err).To(HaveOccurred())
+			Expect(t.errors).To(HaveLen(1))
+			Expect(t.errors[0]).To(ContainSubstring("GET http://example.com/"))
+			Expect(t.errors[0]).To(ContainSubstring("Did you forget to add the interceptor?"))
+		})
+		It("restores a replaced default transport on cleanup", func() {
+			original := http.DefaultTransport
+			gnock.New(t).ReplaceDefault()
+			Expect(http.DefaultTransport).ToNot(BeIdenticalTo(original))
+
+			t.cleanup()
+			Expect(http.DefaultTransport).To(BeIdenticalTo(original))
+		})
+	})
+	Describe("Unmatched request policies", func() {
+		req := func() *http.Request {
+			return newRequest("GET", "http://example.com/other", nil)
+		}
+
+		It("can return a *NoMatchError", func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.ErrorOnUnmatched)
+
+			_, err := transport.RoundTrip(req())
+			Expect(err).To(BeAssignableToTypeOf(&gnock.NoMatchError{}))
+			Expect(err.Error()).To(ContainSubstring("GET http://example.com/other"))
+		})
+		It("can respond with a status and the diagnostic as body", func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.RespondOnUnmatched(501))
+
+			res := mustRoundTrip(transport, req())
+			Expect(res.StatusCode).To(Equal(501))
+			Expect(toString(res.Body)).To(ContainSubstring("Did you forget to add the interceptor?"))
+		})
+		It("can pass requests through to a fallback transport", func() {
+			fallback := gnock.Gnock("http://example.com").
+				Get("/other").
+				Reply(200, "fallback")
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.PassthroughOnUnmatched(fallback))
+
+			res := mustRoundTrip(transport, req())
+			Expect(toString(res.Body)).To(Equal("fallback"))
+		})
+		It("uses the policy of the scope closest to the request", func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Gnock("http://other.com").
+				OnUnmatched(gnock.RespondOnUnmatched(501))
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://other.com/", nil))
+			Expect(res.StatusCode).To(Equal(501))
+
+			_, err := transport.RoundTrip(req())
+			Expect(err).To(HaveOccurred())
+
+			_, err = transport.RoundTrip(newRequest("GET", "http://unknown.com/", nil))
+			Expect(err).To(HaveOccurred())
+		})
+		It("can change the policy globally", func() {
+			gnock.SetDefaultUnmatchedPolicy(gnock.ErrorOnUnmatched)
+			defer gnock.SetDefaultUnmatchedPolicy(nil)
+
+			_, err := gnock.Gnock("http://example.com").RoundTrip(req())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("NoMatchError", func() {
+		var err *gnock.NoMatchError
+
+		BeforeEach(func() {
+			transport := gnock.Gnock("http://example.com").
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Post("/widgets").
+				MatchHeader("Accept", "application/json").
+				Reply(201, "").
+				Get("/gadgets").
+				Reply(200, "")
+
+			_, roundTripErr := transport.RoundTrip(newRequest("GET", "http://EXAMPLE.com/widgets?page=1", nil))
+			Expect(roundTripErr).To(BeAssignableToTypeOf(&gnock.NoMatchError{}))
+			err = roundTripErr.(*gnock.NoMatchError)
+		})
+		It("carries the request and candidate interceptors with every mismatch reason", func() {
+			Expect(err.Method).To(Equal("GET"))
+			Expect(err.URL).To(Equal("http://example.com/widgets?page=1"))
+			Expect(err.Strategy).To(Equal(gnock.FirstMatch))
+			Expect(err.Candidates).To(HaveLen(2))
+			Expect(err.Candidates[0].Description).To(Equal("POST http://example.com/widgets [header Accept: application/json]"))
+			Expect(err.Candidates[0].Reasons).To(Equal([]string{
+				"method: expected POST, got GET",
+				`expected header Accept: application/json, got []`,
+			}))
+			Expect(err.Candidates[1].Reasons).To(Equal([]string{"path: expected /gadgets, got /widgets"}))
+			Expect(err.Suggestion).To(Equal(`gnock.Gnock("http://example.com").
+	Get("/widgets").
+	Query(url.Values{"page": {"1"}}).
+	Reply(200, "OK")`))
+		})
+		It("can be marshalled to JSON", func() {
+			data, marshalErr := json.Marshal(err)
+			Expect(marshalErr).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"strategy":"first match"`))
+			Expect(string(data)).To(ContainSubstring(`"reasons":["path: expected /gadgets, got /widgets"]`))
+		})
+	})
 	It("allows responses to be customized with custom responder function", func() {
 		transport := gnock.Gnock("http://example.com").
 			Get("/").
@@ -392,6 +1607,372 @@ var _ = Describe("gnock", func() {
 			Expect(toString(res.Body)).To(MatchJSON(`{"key":"value"}`))
 		})
 	})
+	Describe("Fixture files", func() {
+		It("replies with the content of a file", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/users/1").
+				ReplyFile(200, "testdata/fixtures/users/1.json")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/users/1", nil))
+			Expect(res.StatusCode).To(Equal(200))
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(res.ContentLength).To(Equal(int64(len(`{"id":1,"name":"Ada"}` + "\n"))))
+			Expect(toString(res.Body)).To(MatchJSON(`{"id":1,"name":"Ada"}`))
+		})
+		It("falls back to a binary content type for unknown extensions", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/blob").
+				ReplyFile(200, "testdata/fixtures/blob.bin")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/blob", nil))
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/octet-stream"))
+			Expect(toString(res.Body)).To(Equal("\x00\x01\x02"))
+		})
+		It("panics if the file does not exist", func() {
+			Expect(func() {
+				gnock.Gnock("http://example.com").
+					Get("/").
+					ReplyFile(200, "testdata/fixtures/missing.json")
+			}).To(Panic())
+		})
+		It("serves every file in a directory", func() {
+			transport := gnock.Gnock("http://example.com").
+				ServeDir("/api", "testdata/fixtures")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/api/users/1.json", nil))
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(toString(res.Body)).To(MatchJSON(`{"id":1,"name":"Ada"}`))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/api/hello.txt", nil))
+			Expect(res.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+			Expect(toString(res.Body)).To(Equal("Hello from a fixture\n"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/api/hello.txt", nil))
+			Expect(toString(res.Body)).To(Equal("Hello from a fixture\n"))
+
+			Expect(transport.Pending()).To(BeEmpty())
+			Expect(transport.Err()).NotTo(HaveOccurred())
+		})
+		It("serves a directory relative to the base path", func() {
+			transport := gnock.Gnock("http://example.com").
+				BasePath("/v2").
+				ServeDir("", "testdata/fixtures")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/v2/users/1.json", nil))
+			Expect(res.StatusCode).To(Equal(200))
+		})
+	})
+	Describe("Templated replies", func() {
+		It("renders the request into the reply", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/widgets/{id:int}").
+				ReplyTemplate(201, `{"id": {{.Params.id}}, "name": "{{.Body.name}}", "via": "{{.Method}} {{.Path}}"}`)
+
+			req := newRequest("POST", "http://example.com/widgets/7", bytes.NewBufferString(`{"name":"sprocket"}`))
+
+			res := mustRoundTrip(transport, req)
+			Expect(res.StatusCode).To(Equal(201))
+			Expect(toString(res.Body)).To(MatchJSON(`{"id": 7, "name": "sprocket", "via": "POST /widgets/7"}`))
+		})
+		It("gives access to the query and headers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/greet").
+				ReplyTemplate(200, `{{.Header.Get "Greeting"}}, {{.Query.Get "name"}}!`)
+
+			req := newRequest("GET", "http://example.com/greet?name=World", nil)
+			req.Header.Set("Greeting", "Hello")
+
+			res := mustRoundTrip(transport, req)
+			Expect(toString(res.Body)).To(Equal("Hello, World!"))
+		})
+		It("can encode values as JSON", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/echo").
+				ReplyTemplate(200, `{"tags": {{json .Body.tags}}}`)
+
+			req := newRequest("POST", "http://example.com/echo", bytes.NewBufferString(`{"tags":["a","b"]}`))
+
+			res := mustRoundTrip(transport, req)
+			Expect(toString(res.Body)).To(MatchJSON(`{"tags": ["a", "b"]}`))
+		})
+		It("exposes bodies that are not JSON as a string", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/echo").
+				ReplyTemplate(200, `echo: {{.Body}}`)
+
+			req := newRequest("POST", "http://example.com/echo", bytes.NewBufferString("plain text"))
+
+			res := mustRoundTrip(transport, req)
+			Expect(toString(res.Body)).To(Equal("echo: plain text"))
+		})
+		It("panics if the template is invalid", func() {
+			Expect(func() {
+				gnock.Gnock("http://example.com").
+					Get("/").
+					ReplyTemplate(200, "{{.Body")
+			}).To(Panic())
+		})
+		It("returns an error if the template can not be rendered", func() {
+			transport := gnock.Gnock("http://example.com").
+				Post("/").
+				ReplyTemplate(200, "{{.Body.missing}}")
+
+			_, err := transport.RoundTrip(newRequest("POST", "http://example.com/", bytes.NewBufferString(`{}`)))
+			Expect(err).To(MatchError(ContainSubstring("missing")))
+		})
+	})
+	Describe("Delays", func() {
+		It("delays the response", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Delay(20*time.Millisecond).
+				Reply(200, "OK")
+
+			start := time.Now()
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(time.Since(start)).To(BeNumerically(">=", 20*time.Millisecond))
+		})
+		It("times out like a real network when the client gives up", func() {
+			client := &http.Client{Transport: gnock.Gnock("http://example.com").
+				Get("/").
+				Delay(time.Minute).
+				Reply(200, "OK")}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := client.Do(newRequest("GET", "http://example.com/", nil).WithContext(ctx))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+		})
+		It("fails when the request is canceled", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Delay(time.Minute).
+				Reply(200, "OK")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/", nil).WithContext(ctx))
+			Expect(err).To(Equal(context.Canceled))
+		})
+		It("can delay the body separately from the headers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				DelayBody(time.Minute).
+				Reply(200, "OK")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil).WithContext(ctx))
+			Expect(res.StatusCode).To(Equal(200))
+
+			_, err := ioutil.ReadAll(res.Body)
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+		It("delays every interceptor in a scope unless overridden", func() {
+			transport := gnock.Gnock("http://example.com").
+				Delay(time.Minute).
+				DelayBody(time.Minute).
+				Get("/slow").
+				Reply(200, "slow").
+				Get("/fast").
+				Delay(time.Millisecond).
+				DelayBody(time.Millisecond).
+				Reply(200, "fast").
+				Get("/instant").
+				Delay(0).
+				DelayBody(0).
+				Reply(200, "instant")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/fast", nil).WithContext(ctx))
+			Expect(toString(res.Body)).To(Equal("fast"))
+
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/instant", nil).WithContext(ctx))
+			Expect(toString(res.Body)).To(Equal("instant"))
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/slow", nil).WithContext(ctx))
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+	})
+	Describe("Clocks", func() {
+		var clock *gnock.FakeClock
+
+		BeforeEach(func() {
+			clock = gnock.NewFakeClock(time.Date(2015, 9, 10, 12, 0, 0, 0, time.UTC))
+		})
+		It("delays responses until the clock is advanced", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				Get("/").
+				Delay(time.Hour).
+				Reply(200, "OK")
+
+			done := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				done <- mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			}()
+
+			Eventually(clock.Waiters).Should(Equal(1))
+			Consistently(done).ShouldNot(Receive())
+			clock.Advance(time.Hour)
+			Eventually(done).Should(Receive())
+		})
+		It("stops waiting when the request is canceled", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				Get("/").
+				Delay(time.Hour).
+				Reply(200, "OK")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/", nil).WithContext(ctx))
+			Expect(err).To(Equal(context.DeadlineExceeded))
+			Expect(clock.Waiters()).To(BeZero())
+		})
+		It("expires interceptors", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				Get("/token").
+				ExpireAfter(time.Minute).
+				Reply(200, "first").
+				Get("/token").
+				Reply(200, "second")
+
+			clock.Advance(time.Minute)
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/token", nil))
+			Expect(toString(res.Body)).To(Equal("second"))
+			Expect(transport.Pending()).To(BeEmpty())
+		})
+		It("expires interceptors registered before the clock was set", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/token").
+				Times(2).
+				ExpireAfter(time.Minute).
+				Reply(200, "first").
+				Get("/token").
+				Reply(200, "second").
+				Clock(clock)
+
+			clock.Advance(59 * time.Second)
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/token", nil))
+			Expect(toString(res.Body)).To(Equal("first"))
+
+			clock.Advance(time.Second)
+			res = mustRoundTrip(transport, newRequest("GET", "http://example.com/token", nil))
+			Expect(toString(res.Body)).To(Equal("second"))
+		})
+		It("tells why an expired interceptor did not match", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				OnUnmatched(gnock.ErrorOnUnmatched).
+				Get("/").
+				ExpireAfter(time.Second).
+				Reply(200, "OK")
+
+			clock.Advance(time.Second)
+
+			_, err := transport.RoundTrip(newRequest("GET", "http://example.com/", nil))
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+		})
+		It("sets Date and Last-Modified headers from the clock", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				Get("/").
+				LastModified(24*time.Hour).
+				Reply(200, "OK")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Header.Get("Date")).To(Equal("Thu, 10 Sep 2015 12:00:00 GMT"))
+			Expect(res.Header.Get("Last-Modified")).To(Equal("Wed, 09 Sep 2015 12:00:00 GMT"))
+		})
+		It("records when requests were received", func() {
+			transport := gnock.Gnock("http://example.com").
+				Clock(clock).
+				Get("/").
+				Times(2).
+				Reply(200, "OK")
+
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			clock.Advance(time.Second)
+			mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+
+			received := transport.Received()
+			Expect(received).To(HaveLen(2))
+			Expect(received[0].Time).To(Equal(time.Date(2015, 9, 10, 12, 0, 0, 0, time.UTC)))
+			Expect(received[1].Time).To(Equal(time.Date(2015, 9, 10, 12, 0, 1, 0, time.UTC)))
+			Expect(received[1].Request.URL.String()).To(Equal("http://example.com/"))
+		})
+	})
+	Describe("Reply headers and trailers", func() {
+		It("replies with the given headers", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				ReplyWithHeaders(200, "OK", http.Header{"X-Request-Id": {"42"}})
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Header.Get("X-Request-Id")).To(Equal("42"))
+			Expect(toString(res.Body)).To(Equal("OK"))
+		})
+		It("adds headers using the builder", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Header("Cache-Control", "no-cache").
+				Header("Vary", "Accept").
+				Header("Vary", "Origin").
+				Reply(200, "OK")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Header.Get("Cache-Control")).To(Equal("no-cache"))
+			Expect(res.Header["Vary"]).To(Equal([]string{"Accept", "Origin"}))
+		})
+		It("takes precedence over the default reply headers of the scope", func() {
+			transport := gnock.Gnock("http://example.com").
+				DefaultReplyHeaders(http.Header{
+					"Location": {"/login"},
+					"Date":     {"2015-09-10"},
+				}).
+				Get("/").
+				Header("Location", "/logout").
+				Reply(200, "OK")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Header["Location"]).To(Equal([]string{"/logout"}))
+			Expect(res.Header["Date"]).To(Equal([]string{"2015-09-10"}))
+		})
+		It("does not overwrite headers set by the reply", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Header("Content-Type", "text/plain").
+				ReplyJSON(200, `{}`)
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Header.Get("Content-Type")).To(Equal("application/json"))
+		})
+		It("fills in trailers once the body has been read", func() {
+			transport := gnock.Gnock("http://example.com").
+				Get("/").
+				Trailer("X-Checksum", "abc").
+				Reply(200, "OK")
+
+			res := mustRoundTrip(transport, newRequest("GET", "http://example.com/", nil))
+			Expect(res.Trailer).To(HaveKey("X-Checksum"))
+			Expect(res.Trailer.Get("X-Checksum")).To(BeEmpty())
+			Expect(res.ContentLength).To(Equal(int64(-1)))
+
+			Expect(toString(res.Body)).To(Equal("OK"))
+			Expect(res.Trailer.Get("X-Checksum")).To(Equal("abc"))
+		})
+	})
 	Describe("An interceptor with default reply headers", func() {
 		var interceptor *gnock.Interceptor
 
@@ -426,6 +2007,46 @@ var _ = Describe("gnock", func() {
 	})
 })
 
+func TestNew(t *testing.T) {
+	client := &http.Client{
+		Transport: gnock.New(t).
+			Gnock("http://example.com").
+			Get("/").
+			Reply(200, "Hello, World!"),
+	}
+
+	res, err := client.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("expected status 200, got %d", res.StatusCode)
+	}
+}
+
+// fakeT records errors and cleanup functions instead of failing the test
+type fakeT struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *fakeT) cleanup() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
 func newRequest(method, url string, body io.Reader) *http.Request {
 	req, err := http.NewRequest(method, url, body)
 	Expect(err).ToNot(HaveOccurred())
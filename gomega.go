@@ -0,0 +1,153 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+)
+
+// Field extracts the part of a request that is matched by MatchWith.
+type Field struct {
+	name    string
+	extract func(*http.Request) interface{}
+}
+
+var (
+	// PathField is the escaped request path as a string, e.g. "/files/a%2Fb",
+	// as matched by all path matchers.
+	PathField = Field{name: "path", extract: func(req *http.Request) interface{} {
+		return requestPath(req)
+	}}
+	// QueryField is the parsed request query as url.Values.
+	QueryField = Field{name: "query", extract: func(req *http.Request) interface{} {
+		return req.URL.Query()
+	}}
+	// BodyField is the request body as a string.
+	BodyField = Field{name: "body", extract: func(req *http.Request) interface{} {
+		return string(readBody(req))
+	}}
+)
+
+// HeaderField is the first value of the named request header as a string.
+func HeaderField(name string) Field {
+	return Field{name: "header " + http.CanonicalHeaderKey(name), extract: func(req *http.Request) interface{} {
+		return req.Header.Get(name)
+	}}
+}
+
+func (f Field) String() string {
+	return f.name
+}
+
+func gomegaMatcher(field Field, matcher types.GomegaMatcher) requestMatcher {
+	return requestMatcher{
+		description: fmt.Sprintf("%s matching %T", field, matcher),
+		matches: func(req *http.Request) (bool, string) {
+			actual := field.extract(req)
+			ok, err := matcher.Match(actual)
+			if err != nil {
+				return false, fmt.Sprintf("%s: %s", field, err)
+			}
+			if !ok {
+				return false, fmt.Sprintf("%s: %s", field, indent(matcher.FailureMessage(actual)))
+			}
+			return true, ""
+		},
+	}
+}
+
+// BeDone succeeds when all interceptors of a *Scope have been used.
+func BeDone() types.GomegaMatcher {
+	return &beDoneMatcher{}
+}
+
+type beDoneMatcher struct {
+	pending     []*Interceptor
+	description string
+}
+
+func (m *beDoneMatcher) Match(actual interface{}) (bool, error) {
+	scope, ok := actual.(*Scope)
+	if !ok {
+		return false, fmt.Errorf("BeDone expects a *gnock.Scope, got %T", actual)
+	}
+	m.pending, m.description = scope.describePending()
+	return len(m.pending) == 0, nil
+}
+
+func (m *beDoneMatcher) FailureMessage(actual interface{}) string {
+	return "Expected all interceptors to have been used, pending:\n" + m.description
+}
+
+func (m *beDoneMatcher) NegatedFailureMessage(actual interface{}) string {
+	return "Expected some interceptors to be pending but all have been used"
+}
+
+// HaveReceivedRequest succeeds when a *Scope has received a request with the
+// given method and URL. The URLs are normalized the same way as when matching
+// interceptors, e.g. "http://Example.com:80/a" equals "http://example.com/a".
+func HaveReceivedRequest(method, url string) types.GomegaMatcher {
+	return &haveReceivedRequestMatcher{method: method, url: url}
+}
+
+type haveReceivedRequestMatcher struct {
+	method   string
+	url      string
+	received []ReceivedRequest
+}
+
+func (m *haveReceivedRequestMatcher) Match(actual interface{}) (bool, error) {
+	scope, ok := actual.(*Scope)
+	if !ok {
+		return false, fmt.Errorf("HaveReceivedRequest expects a *gnock.Scope, got %T", actual)
+	}
+	expected, err := url.Parse(m.url)
+	if err != nil {
+		return false, err
+	}
+	m.received = scope.Received()
+	for _, received := range m.received {
+		req := received.Request
+		if req.Method == strings.ToUpper(m.method) && normalizeURL(req.URL) == normalizeURL(expected) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *haveReceivedRequestMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected to have received %s %s, received:\n%s", m.method, m.url, describeRequestList(m.received))
+}
+
+func (m *haveReceivedRequestMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected not to have received %s %s", m.method, m.url)
+}
+
+func describeInterceptorList(interceptors []*Interceptor) string {
+	result := ""
+	for _, i := range interceptors {
+		result += i.String()
+	}
+	if result == "" {
+		return "none\n"
+	}
+	return result
+}
+
+func describeRequestList(requests []ReceivedRequest) string {
+	result := ""
+	for _, received := range requests {
+		result += received.String() + "\n"
+	}
+	if result == "" {
+		return "none\n"
+	}
+	return result
+}
+
+func indent(text string) string {
+	return strings.Replace(strings.TrimSpace(text), "\n", "\n\t\t", -1)
+}
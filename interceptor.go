@@ -1,40 +1,61 @@
 package gnock
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega/types"
 )
 
 type Interceptor struct {
-	scope      *Scope
-	method     string
-	path       string
-	pathRegexp *regexp.Regexp
-	responder  Responder
-	times      int
+	scope         *Scope
+	methods       []string
+	pathMatcher   Matcher
+	matchers      []Matcher
+	responder     Responder
+	times         int
+	unlimited     bool
+	priority      int
+	headTimes     int
+	headBudget    bool
+	captured      []Params
+	headerDelay   time.Duration
+	headerDelayed bool
+	bodyDelay     time.Duration
+	bodyDelayed   bool
+	expireAfter   time.Duration
+	expires       time.Time
+	modifiedAgo   time.Duration
+	modified      bool
+	header        http.Header
+	trailer       http.Header
 }
 
 type Responder func(*http.Request) (*http.Response, error)
 
 func NewInterceptor(scope *Scope, method string, path string) *Interceptor {
 	return &Interceptor{
-		scope:  scope,
-		method: method,
-		path:   path,
-		times:  1,
+		scope:       scope,
+		methods:     []string{method},
+		pathMatcher: newPathMatcher(path),
+		times:       1,
 	}
 }
 
 func NewRegexpInterceptor(scope *Scope, method string, pathRegexp *regexp.Regexp) *Interceptor {
 	return &Interceptor{
-		scope:      scope,
-		method:     method,
-		pathRegexp: pathRegexp,
-		times:      1,
+		scope:       scope,
+		methods:     []string{method},
+		pathMatcher: pathRegexpMatcher(pathRegexp),
+		times:       1,
 	}
 }
 
@@ -43,16 +64,205 @@ func (i *Interceptor) Times(times int) *Interceptor {
 	return i
 }
 
+// Priority makes the interceptor serve matching requests before interceptors
+// with a lower priority regardless of registration order. The default is 0.
+func (i *Interceptor) Priority(priority int) *Interceptor {
+	i.priority = priority
+	return i
+}
+
+// HeadTimes gives HEAD requests served by a GET interceptor, see
+// Scope.HeadFromGet, a budget separate from Times.
+func (i *Interceptor) HeadTimes(times int) *Interceptor {
+	i.headTimes = times
+	i.headBudget = true
+	return i
+}
+
+// Delay delays the response headers, see DelayHeaders.
+func (i *Interceptor) Delay(d time.Duration) *Interceptor {
+	return i.DelayHeaders(d)
+}
+
+// DelayHeaders makes the round trip wait before returning the response, like
+// a slow server. It overrides the delay of the scope. If the request context is
+// done before the delay has passed the round trip fails with the error of the
+// context, e.g. context.DeadlineExceeded.
+func (i *Interceptor) DelayHeaders(d time.Duration) *Interceptor {
+	i.headerDelay = d
+	i.headerDelayed = true
+	return i
+}
+
+// DelayBody makes the first read of the response body wait, like a server that
+// is slow to send the body. It overrides the delay of the scope. If the
+// request context is done before the delay has passed the read fails with the
+// error of the context.
+func (i *Interceptor) DelayBody(d time.Duration) *Interceptor {
+	i.bodyDelay = d
+	i.bodyDelayed = true
+	return i
+}
+
+// ExpireAfter makes the interceptor stop matching once the duration has passed
+// on the clock of the scope, like a token or a cached entry expiring. The
+// duration counts from now, or from when Scope.Clock is set if that happens
+// later. An expired interceptor is no longer pending.
+func (i *Interceptor) ExpireAfter(d time.Duration) *Interceptor {
+	i.expireAfter = d
+	i.startExpiry()
+	return i
+}
+
+func (i *Interceptor) startExpiry() {
+	i.expires = i.scope.clockOrDefault().Now().Add(i.expireAfter)
+}
+
+// LastModified sets the Last-Modified header of responses to the given age
+// before the time of the clock of the scope when responding.
+func (i *Interceptor) LastModified(age time.Duration) *Interceptor {
+	i.modifiedAgo = age
+	i.modified = true
+	return i
+}
+
+// Query matches when the request has exactly the given query parameters.
+func (i *Interceptor) Query(query url.Values) *Interceptor {
+	return i.addMatcher(queryMatcher(query))
+}
+
+// QueryContains matches when the request has at least the given query
+// parameters, any other parameters are ignored.
+func (i *Interceptor) QueryContains(query url.Values) *Interceptor {
+	return i.addMatcher(queryContainsMatcher(query))
+}
+
+// QueryRegexp matches when every given query parameter is present and all of
+// its values match the corresponding regexp.
+func (i *Interceptor) QueryRegexp(params map[string]string) *Interceptor {
+	regexps := make(map[string]*regexp.Regexp, len(params))
+	for key, pattern := range params {
+		regexps[key] = regexp.MustCompile(pattern)
+	}
+	return i.addMatcher(queryRegexpMatcher(regexps))
+}
+
+func (i *Interceptor) QueryFunc(predicate func(url.Values) bool) *Interceptor {
+	return i.addMatcher(queryFuncMatcher(predicate))
+}
+
+func (i *Interceptor) MatchHeader(name, value string) *Interceptor {
+	return i.addMatcher(headerMatcher(name, value))
+}
+
+func (i *Interceptor) MatchHeaderRegexp(name, pattern string) *Interceptor {
+	return i.addMatcher(headerRegexpMatcher(name, regexp.MustCompile(pattern)))
+}
+
+func (i *Interceptor) MatchHeaderAbsent(name string) *Interceptor {
+	return i.addMatcher(headerAbsentMatcher(name))
+}
+
+func (i *Interceptor) Body(body string) *Interceptor {
+	return i.addMatcher(bodyMatcher(body))
+}
+
+func (i *Interceptor) BodyRegexp(pattern string) *Interceptor {
+	return i.addMatcher(bodyRegexpMatcher(regexp.MustCompile(pattern)))
+}
+
+// JSONBody matches when the request body is JSON equivalent to the given
+// value, ignoring key order and whitespace. The value is accepted in the same
+// forms as ReplyJSON.
+func (i *Interceptor) JSONBody(json interface{}) *Interceptor {
+	return i.addMatcher(jsonBodyMatcher(json))
+}
+
+// JSONBodyContains matches when the request body is a JSON document that
+// contains the given subset. Objects may have additional keys while arrays
+// must have the same length with each element containing the expected one.
+func (i *Interceptor) JSONBodyContains(subset interface{}) *Interceptor {
+	return i.addMatcher(jsonBodyContainsMatcher(subset))
+}
+
+// JSONPath matches when the value found at the JSONPath expression, e.g.
+// "$.items[0].sku", in the JSON request body equals the given value.
+func (i *Interceptor) JSONPath(expression string, value interface{}) *Interceptor {
+	return i.addMatcher(jsonPathMatcher(mustParseJSONPath(expression), value))
+}
+
+// FormBody matches when the request body is an URL encoded form with exactly
+// the given values.
+func (i *Interceptor) FormBody(form url.Values) *Interceptor {
+	return i.addMatcher(formBodyMatcher(form))
+}
+
+// MultipartField matches when the multipart request body has a non file field
+// with the given value.
+func (i *Interceptor) MultipartField(name, value string) *Interceptor {
+	return i.addMatcher(multipartFieldMatcher(name, value))
+}
+
+// MultipartFile matches when the multipart request body has a file with the
+// given field name, file name and content. An empty content type matches any
+// part content type.
+func (i *Interceptor) MultipartFile(name, fileName, contentType, content string) *Interceptor {
+	return i.addMatcher(multipartFileMatcher(name, fileName, contentType, content))
+}
+
+// Match adds custom matchers that must all match for the request to be
+// intercepted.
+func (i *Interceptor) Match(matchers ...Matcher) *Interceptor {
+	i.matchers = append(i.matchers, matchers...)
+	return i
+}
+
+// MatchWith matches a field of the request using a Gomega matcher, e.g.
+// MatchWith(gnock.BodyField, MatchJSON(`{"key":"value"}`)).
+func (i *Interceptor) MatchWith(field Field, matcher types.GomegaMatcher) *Interceptor {
+	return i.addMatcher(gomegaMatcher(field, matcher))
+}
+
+func (i *Interceptor) addMatcher(m Matcher) *Interceptor {
+	i.matchers = append(i.matchers, m)
+	return i
+}
+
 func (i *Interceptor) Reply(status int, body string) *Scope {
 	return i.Respond(func(req *http.Request) (*http.Response, error) {
-		return &http.Response{
-			Request:    req,
-			StatusCode: status,
-			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
-		}, nil
+		return newResponse(req, status, body, nil), nil
 	})
 }
 
+// ReplyWithHeaders is like Reply but also responds with the given headers.
+func (i *Interceptor) ReplyWithHeaders(status int, body string, header http.Header) *Scope {
+	return i.Respond(func(req *http.Request) (*http.Response, error) {
+		return newResponse(req, status, body, header.Clone()), nil
+	})
+}
+
+// Header adds a header to the responses of the interceptor. Like the default
+// reply headers of the scope, which it takes precedence over, it does not
+// overwrite a header already set by the reply.
+func (i *Interceptor) Header(name, value string) *Interceptor {
+	if i.header == nil {
+		i.header = make(http.Header)
+	}
+	i.header.Add(name, value)
+	return i
+}
+
+// Trailer adds a trailer to the responses of the interceptor. As with a real
+// transport the trailer values are only available in Response.Trailer once the
+// body has been read to the end.
+func (i *Interceptor) Trailer(name, value string) *Interceptor {
+	if i.trailer == nil {
+		i.trailer = make(http.Header)
+	}
+	i.trailer.Add(name, value)
+	return i
+}
+
 func (i *Interceptor) ReplyError(err error) *Scope {
 	return i.Respond(func(req *http.Request) (*http.Response, error) {
 		return nil, err
@@ -61,12 +271,31 @@ func (i *Interceptor) ReplyError(err error) *Scope {
 
 func (i *Interceptor) ReplyJSON(status int, json interface{}) *Scope {
 	return i.Respond(func(req *http.Request) (*http.Response, error) {
-		return &http.Response{
-			Request:    req,
-			StatusCode: status,
-			Body:       ioutil.NopCloser(bytes.NewBufferString(jsonToString(json))),
-			Header:     http.Header{"Content-Type": []string{"application/json"}},
-		}, nil
+		return newResponse(req, status, jsonToString(json), http.Header{"Content-Type": []string{"application/json"}}), nil
+	})
+}
+
+// ReplyFile replies with the content of the file, e.g. a fixture under
+// testdata, with a Content-Type guessed from its extension. The file is opened
+// anew for every response so that it may be large or change between requests.
+func (i *Interceptor) ReplyFile(status int, path string) *Scope {
+	if _, err := os.Stat(path); err != nil {
+		panic(err.Error())
+	}
+	return i.Respond(func(req *http.Request) (*http.Response, error) {
+		return newFileResponse(req, status, path)
+	})
+}
+
+// ReplyTemplate replies with the text/template rendered with TemplateData of
+// the request, e.g. `{"id": {{.Params.id}}, "name": {{json .Body.name}}}`
+// where the json function encodes a value as JSON. The template is parsed
+// immediately and panics if it is invalid while errors executing it are
+// returned from the round trip.
+func (i *Interceptor) ReplyTemplate(status int, tmpl string) *Scope {
+	parsed := mustParseReplyTemplate(tmpl)
+	return i.RespondWithParams(func(req *http.Request, params Params) (*http.Response, error) {
+		return renderTemplate(req, status, parsed, newTemplateData(req, params))
 	})
 }
 
@@ -75,8 +304,23 @@ func (i *Interceptor) Respond(responder Responder) *Scope {
 	return i.scope
 }
 
+// RespondWithParams is like Respond but also passes the parameters captured by
+// a path template such as "/widgets/{id:int}" to the responder.
+func (i *Interceptor) RespondWithParams(responder ParamsResponder) *Scope {
+	return i.Respond(func(req *http.Request) (*http.Response, error) {
+		return responder(req, i.params(req))
+	})
+}
+
 func (i *Interceptor) String() string {
-	methodAndURL := fmt.Sprintf("%s %s%s", i.method, i.scope.String(), i.describePath())
+	methodAndURL := fmt.Sprintf("%s %s%s", describeMethods(i.methods), i.scope.String(), i.describePath())
+	methodAndURL += describeMatchers(i.scope.matchers) + describeMatchers(i.matchers)
+	if i.priority != 0 {
+		methodAndURL += fmt.Sprintf(" (priority %d)", i.priority)
+	}
+	if len(i.captured) > 0 {
+		methodAndURL += " (captured " + describeCaptured(i.captured) + ")"
+	}
 	if i.whollyDefined() {
 		return methodAndURL + "\n"
 	}
@@ -84,29 +328,67 @@ func (i *Interceptor) String() string {
 }
 
 func (i *Interceptor) describePath() string {
-	if i.pathRegexp != nil {
-		return i.pathRegexp.String()
-	}
-	return i.path
+	return describeMatcher(i.pathMatcher)
 }
 
 func (i *Interceptor) intercepts(req *http.Request) bool {
+	return i.mismatch(req) == ""
+}
+
+// mismatch returns the reason why the interceptor does not intercept the
+// request or an empty string if it does.
+func (i *Interceptor) mismatch(req *http.Request) string {
 	if i.partiallyDefined() {
-		return false
+		return "no reply defined"
 	}
-	if i.times < 1 {
-		return false
+	if i.usedUp() {
+		return "already used"
 	}
-	if !i.scope.intercepts(req) {
-		return false
+	if i.expired() {
+		return "expired"
+	}
+	return firstMismatch(i.allMatchers(), req)
+}
+
+// mismatches returns every reason why the interceptor does not intercept the
+// request.
+func (i *Interceptor) mismatches(req *http.Request) []string {
+	reasons := make([]string, 0)
+	if i.partiallyDefined() {
+		reasons = append(reasons, "no reply defined")
 	}
-	if req.Method != i.method {
+	if i.usedUp() {
+		reasons = append(reasons, "already used")
+	}
+	if i.expired() {
+		reasons = append(reasons, "expired")
+	}
+	for _, m := range i.allMatchers() {
+		if reason := firstMismatch([]Matcher{m}, req); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// interceptsHead returns whether the interceptor serves the HEAD request as if
+// it was a GET request.
+func (i *Interceptor) interceptsHead(req *http.Request) bool {
+	if req.Method != "HEAD" || !i.scope.headFromGet || i.partiallyDefined() {
 		return false
 	}
-	if i.pathRegexp != nil {
-		return i.pathRegexp.MatchString(req.URL.Path)
+	if i.headBudget && i.headTimes < 1 || !i.headBudget && i.usedUp() || i.expired() {
+		return false
 	}
-	return i.path == req.URL.Path
+	return firstMismatch(i.allMatchers(), withMethod(req, "GET")) == ""
+}
+
+// allMatchers returns the matchers of the scope followed by the method, path
+// and custom matchers of the interceptor.
+func (i *Interceptor) allMatchers() []Matcher {
+	matchers := i.scope.allMatchers()
+	matchers = append(matchers, methodMatcher(i.methods), i.scope.scopedPathMatcher(i.pathMatcher))
+	return append(matchers, i.matchers...)
 }
 
 func (i *Interceptor) whollyDefined() bool {
@@ -117,8 +399,75 @@ func (i *Interceptor) partiallyDefined() bool {
 	return !i.whollyDefined()
 }
 
+func (i *Interceptor) params(req *http.Request) Params {
+	if template, ok := i.pathMatcher.(*pathTemplate); ok {
+		relative := requestPath(req)
+		if relativeReq, ok := i.scope.relativeRequest(req); ok {
+			relative = requestPath(relativeReq)
+		}
+		if params, ok := template.params(relative); ok {
+			return params
+		}
+		// The path may only have matched after toggling the trailing slash
+		if params, ok := template.params(toggleTrailingSlash(relative)); ok && i.scope.ignoreTrailing {
+			return params
+		}
+	}
+	return Params{}
+}
+
+// usedUp returns whether the interceptor has been used as many times as
+// expected and can not be used anymore.
+func (i *Interceptor) usedUp() bool {
+	return !i.unlimited && i.times < 1
+}
+
+// pending returns whether the interceptor is expected to be used more times,
+// either by its own requests or by HEAD requests with a separate budget.
+func (i *Interceptor) pending() bool {
+	if i.expired() {
+		return false
+	}
+	return !i.usedUp() && !i.unlimited || i.headBudget && i.headTimes > 0
+}
+
+// use counts the request against the budget of the interceptor.
+func (i *Interceptor) use(req *http.Request) {
+	if !i.unlimited {
+		i.times--
+	}
+	i.capture(req)
+}
+
+// useHead counts the HEAD request against the HEAD budget of the interceptor
+// if it has one, see HeadTimes.
+func (i *Interceptor) useHead(req *http.Request) {
+	if i.headBudget {
+		i.headTimes--
+	} else if !i.unlimited {
+		i.times--
+	}
+	i.capture(req)
+}
+
+func (i *Interceptor) capture(req *http.Request) {
+	if _, ok := i.pathMatcher.(*pathTemplate); ok {
+		i.captured = append(i.captured, i.params(req))
+	}
+}
+
 func (i *Interceptor) respond(req *http.Request) (*http.Response, error) {
-	i.times--
+	res, err := i.serve(req)
+	if err != nil {
+		return res, err
+	}
+	return delayBody(req, res, i.scope.clockOrDefault(), i.bodyDelayOrDefault()), nil
+}
+
+func (i *Interceptor) serve(req *http.Request) (*http.Response, error) {
+	if err := wait(req.Context(), i.scope.clockOrDefault(), i.headerDelayOrDefault()); err != nil {
+		return nil, err
+	}
 
 	res, err := i.responder(req)
 	if err != nil {
@@ -126,7 +475,53 @@ func (i *Interceptor) respond(req *http.Request) (*http.Response, error) {
 		return res, err
 	}
 
-	return i.setDefaultHeaders(res), nil
+	res = i.setDefaultHeaders(i.setHeaders(normalizeResponse(req, res)))
+	res = withTrailer(res, i.trailer)
+	if i.modified && res.Header.Get("Last-Modified") == "" {
+		modified := i.scope.clockOrDefault().Now().Add(-i.modifiedAgo)
+		res.Header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	return res, nil
+}
+
+func (i *Interceptor) expired() bool {
+	return !i.expires.IsZero() && !i.scope.clockOrDefault().Now().Before(i.expires)
+}
+
+func (i *Interceptor) respondHead(req *http.Request) (*http.Response, error) {
+	res, err := i.serve(withMethod(req, "GET"))
+	if err != nil {
+		return res, err
+	}
+
+	res.Request = req
+	if res.Body != nil {
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.ContentLength <= 0 && res.Header.Get("Content-Length") == "" {
+			res.ContentLength = int64(len(body))
+		}
+	}
+	if res.ContentLength > 0 && res.Header.Get("Content-Length") == "" {
+		if res.Header == nil {
+			res.Header = make(http.Header)
+		}
+		res.Header.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+	}
+	res.Body = http.NoBody
+	return res, nil
+}
+
+func (i *Interceptor) setHeaders(res *http.Response) *http.Response {
+	for headerKey, headerValues := range i.header {
+		if len(res.Header[headerKey]) == 0 {
+			res.Header[headerKey] = append([]string(nil), headerValues...)
+		}
+	}
+	return res
 }
 
 func (i *Interceptor) setDefaultHeaders(res *http.Response) *http.Response {
@@ -152,3 +547,27 @@ func jsonToString(input interface{}) string {
 	}
 	return string(buf)
 }
+
+func withMethod(req *http.Request, method string) *http.Request {
+	clone := *req
+	clone.Method = method
+	return &clone
+}
+
+func newPathMatcher(path string) Matcher {
+	if isGlob(path) {
+		return pathGlobMatcher(path)
+	}
+	if isPathTemplate(path) {
+		return mustParsePathTemplate(path)
+	}
+	return pathMatcher(path)
+}
+
+func describeCaptured(captured []Params) string {
+	parts := make([]string, 0, len(captured))
+	for _, params := range captured {
+		parts = append(parts, params.String())
+	}
+	return strings.Join(parts, ", ")
+}
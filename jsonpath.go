@@ -0,0 +1,118 @@
+package gnock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed subset of JSONPath supporting the root "$", member
+// access using ".name" or "['name']" and array indexes like "[0]".
+type jsonPath []jsonPathSegment
+
+type jsonPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func mustParseJSONPath(expression string) jsonPath {
+	path, err := parseJSONPath(expression)
+	if err != nil {
+		panic(fmt.Sprintf("invalid JSON path %q: %s", expression, err))
+	}
+	return path
+}
+
+func parseJSONPath(expression string) (jsonPath, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, fmt.Errorf("must start with $")
+	}
+	path := jsonPath{}
+	rest := expression[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty member name")
+			}
+			path = path.key(key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [")
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = path.key(inner[1 : len(inner)-1])
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid array index %q", inner)
+				}
+				path = path.index(index)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	return path, nil
+}
+
+func (p jsonPath) key(key string) jsonPath {
+	return p.append(jsonPathSegment{key: key})
+}
+
+func (p jsonPath) index(index int) jsonPath {
+	return p.append(jsonPathSegment{index: index, isIndex: true})
+}
+
+func (p jsonPath) append(segment jsonPathSegment) jsonPath {
+	// Copy to keep sibling paths sharing a prefix from overwriting each other
+	result := make(jsonPath, len(p), len(p)+1)
+	copy(result, p)
+	return append(result, segment)
+}
+
+func (p jsonPath) lookup(document interface{}) (interface{}, bool) {
+	current := document
+	for _, segment := range p {
+		if segment.isIndex {
+			array, ok := current.([]interface{})
+			if !ok || segment.index >= len(array) {
+				return nil, false
+			}
+			current = array[segment.index]
+			continue
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[segment.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (p jsonPath) String() string {
+	result := "$"
+	for _, segment := range p {
+		if segment.isIndex {
+			result += fmt.Sprintf("[%d]", segment.index)
+		} else if strings.ContainsAny(segment.key, ".[]'\" ") {
+			result += fmt.Sprintf("['%s']", segment.key)
+		} else {
+			result += "." + segment.key
+		}
+	}
+	return result
+}
@@ -0,0 +1,341 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matcher decides whether a request should be intercepted. When it does not
+// match it returns the reason why, which is shown when Gnock finds no match
+// for a request. A Matcher may also implement fmt.Stringer to describe itself
+// in the list of registered interceptors. Matchers run while the scope
+// hierarchy is locked so they must not call methods of a Scope such as
+// Received or Pending, which would block forever.
+type Matcher interface {
+	Match(req *http.Request) (ok bool, reason string)
+}
+
+// MatcherFunc adapts an ordinary function to the Matcher interface.
+type MatcherFunc func(req *http.Request) (ok bool, reason string)
+
+func (f MatcherFunc) Match(req *http.Request) (bool, string) {
+	return f(req)
+}
+
+type requestMatcher struct {
+	description string
+	// matches returns whether the request matched and, if not, the reason why.
+	matches func(*http.Request) (bool, string)
+	// specificity ranks host and path matchers for the MostSpecific strategy.
+	specificity int
+}
+
+func (m requestMatcher) Match(req *http.Request) (bool, string) {
+	ok, reason := m.matches(req)
+	if ok {
+		return true, ""
+	}
+	return false, reason
+}
+
+func (m requestMatcher) String() string {
+	return m.description
+}
+
+func firstMismatch(matchers []Matcher, req *http.Request) string {
+	for _, m := range matchers {
+		if ok, reason := m.Match(req); !ok {
+			if reason == "" {
+				reason = "expected " + describeMatcher(m)
+			}
+			return reason
+		}
+	}
+	return ""
+}
+
+func describeMatchers(matchers []Matcher) string {
+	result := ""
+	for _, m := range matchers {
+		result += " [" + describeMatcher(m) + "]"
+	}
+	return result
+}
+
+func describeMatcher(m Matcher) string {
+	if stringer, ok := m.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", m)
+}
+
+// hostMatcher expects host to already be normalized. A scheme relative host
+// such as "//example.com" matches any scheme.
+func hostMatcher(host string) requestMatcher {
+	description := describeSchemeAndHost(host)
+	scheme, hostAndPort := splitSchemeAndHost(host)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := requestSchemeAndHost(req)
+			actualScheme, actualHostAndPort := splitSchemeAndHost(actual)
+			expected := hostAndPort
+			if scheme == "" {
+				// The default port of a scheme relative host depends on the
+				// scheme of the request, e.g. "//example.com:443" is
+				// normalized to "https://example.com"
+				expected = normalizeHost(actualScheme, hostAndPort)
+			}
+			ok := actualHostAndPort == expected && (scheme == "" || actualScheme == scheme)
+			return ok, fmt.Sprintf("host: expected %s, got %s", description, actual)
+		},
+		specificity: exactSpecificity,
+	}
+}
+
+// noHostMatcher is used by root scopes that only hold other scopes.
+func noHostMatcher() requestMatcher {
+	return requestMatcher{
+		description: "(no host)",
+		matches: func(req *http.Request) (bool, string) {
+			return false, "host: scope has no host"
+		},
+	}
+}
+
+func anyHostMatcher(hostMatchers []Matcher) requestMatcher {
+	descriptions := make([]string, 0, len(hostMatchers))
+	for _, m := range hostMatchers {
+		descriptions = append(descriptions, describeMatcher(m))
+	}
+	description := "{" + strings.Join(descriptions, ", ") + "}"
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			for _, m := range hostMatchers {
+				if ok, _ := m.Match(req); ok {
+					return true, ""
+				}
+			}
+			return false, fmt.Sprintf("host: expected one of %s, got %s", description, requestSchemeAndHost(req))
+		},
+		specificity: minSpecificity(hostMatchers),
+	}
+}
+
+func hostRegexpMatcher(re *regexp.Regexp) requestMatcher {
+	return requestMatcher{
+		description: re.String(),
+		matches: func(req *http.Request) (bool, string) {
+			actual := requestSchemeAndHost(req)
+			return re.MatchString(actual), fmt.Sprintf("host: expected to match %s, got %s", re, actual)
+		},
+		specificity: regexpSpecificity,
+	}
+}
+
+// methodMatcher matches any of the methods or any method at all if nil.
+func methodMatcher(methods []string) requestMatcher {
+	description := describeMethods(methods)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			ok := methods == nil || containsString(methods, req.Method)
+			return ok, fmt.Sprintf("method: expected %s, got %s", description, req.Method)
+		},
+	}
+}
+
+func describeMethods(methods []string) string {
+	if methods == nil {
+		return "ANY"
+	}
+	return strings.Join(methods, "|")
+}
+
+func pathMatcher(path string) requestMatcher {
+	expected := escapePath(path)
+	return requestMatcher{
+		description: path,
+		matches: func(req *http.Request) (bool, string) {
+			actual := requestPath(req)
+			return actual == expected, fmt.Sprintf("path: expected %s, got %s", expected, actual)
+		},
+		specificity: exactSpecificity,
+	}
+}
+
+// pathRegexpMatcher matches the decoded path, e.g. "/a b", unlike the other
+// path matchers which match the escaped path, e.g. "/a%20b", so that existing
+// regexps keep matching. An encoded slash therefore can not be told apart
+// from a path separator with a regexp.
+func pathRegexpMatcher(re *regexp.Regexp) requestMatcher {
+	return requestMatcher{
+		description: re.String(),
+		matches: func(req *http.Request) (bool, string) {
+			return re.MatchString(req.URL.Path), fmt.Sprintf("path: expected to match %s, got %s", re, req.URL.Path)
+		},
+		specificity: regexpSpecificity,
+	}
+}
+
+func headerMatcher(name, value string) requestMatcher {
+	description := fmt.Sprintf("header %s: %s", http.CanonicalHeaderKey(name), value)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.Header.Values(name)
+			return containsString(actual, value), fmt.Sprintf("expected %s, got %q", description, actual)
+		},
+	}
+}
+
+func headerRegexpMatcher(name string, re *regexp.Regexp) requestMatcher {
+	description := fmt.Sprintf("header %s =~ %s", http.CanonicalHeaderKey(name), re.String())
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.Header.Values(name)
+			for _, value := range actual {
+				if re.MatchString(value) {
+					return true, ""
+				}
+			}
+			return false, fmt.Sprintf("expected %s, got %q", description, actual)
+		},
+	}
+}
+
+func headerAbsentMatcher(name string) requestMatcher {
+	description := fmt.Sprintf("header %s absent", http.CanonicalHeaderKey(name))
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.Header.Values(name)
+			return len(actual) == 0, fmt.Sprintf("expected %s, got %q", description, actual)
+		},
+	}
+}
+
+func queryMatcher(query url.Values) requestMatcher {
+	description := "query " + describeQuery(query)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.URL.Query()
+			return queryEquals(query, actual), fmt.Sprintf("expected %s, got %s", description, describeQuery(actual))
+		},
+	}
+}
+
+func queryContainsMatcher(query url.Values) requestMatcher {
+	description := "query contains " + describeQuery(query)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.URL.Query()
+			return queryContains(query, actual), fmt.Sprintf("expected %s, got %s", description, describeQuery(actual))
+		},
+	}
+}
+
+func queryRegexpMatcher(regexps map[string]*regexp.Regexp) requestMatcher {
+	description := "query matching " + describeQueryRegexps(regexps)
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.URL.Query()
+			return queryMatches(regexps, actual), fmt.Sprintf("expected %s, got %s", description, describeQuery(actual))
+		},
+	}
+}
+
+func queryFuncMatcher(predicate func(url.Values) bool) requestMatcher {
+	description := "query matching func"
+	return requestMatcher{
+		description: description,
+		matches: func(req *http.Request) (bool, string) {
+			actual := req.URL.Query()
+			return predicate(actual), fmt.Sprintf("expected %s, got %s", description, describeQuery(actual))
+		},
+	}
+}
+
+func queryEquals(expected, actual url.Values) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for key, values := range expected {
+		if !stringsEqual(values, actual[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+func queryContains(expected, actual url.Values) bool {
+	for key, values := range expected {
+		if _, ok := actual[key]; !ok {
+			return false
+		}
+		for _, value := range values {
+			if !containsString(actual[key], value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func queryMatches(regexps map[string]*regexp.Regexp, actual url.Values) bool {
+	for key, re := range regexps {
+		if len(actual[key]) == 0 {
+			return false
+		}
+		for _, value := range actual[key] {
+			if !re.MatchString(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func describeQuery(query url.Values) string {
+	// url.Values.Encode sorts by key which keeps descriptions stable
+	return query.Encode()
+}
+
+func describeQueryRegexps(regexps map[string]*regexp.Regexp) string {
+	parts := make([]string, 0, len(regexps))
+	for key, re := range regexps {
+		parts = append(parts, key+"=~"+re.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NoMatchError describes a request that no interceptor matched. Besides
+// rendering a human readable report using Error it carries the diagnostics as
+// structured data, which can also be marshalled to JSON, for custom reporting.
+type NoMatchError struct {
+	Request *http.Request `json:"-"`
+	// Method and URL of the request, the URL is normalized the same way as
+	// when matching.
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Strategy is the match strategy of the scope hierarchy.
+	Strategy MatchStrategy `json:"strategy"`
+	// Candidates are all registered interceptors in the order they are
+	// considered.
+	Candidates []Candidate `json:"candidates"`
+	// Suggestion is Go code adding an interceptor for the request.
+	Suggestion string `json:"suggestion"`
+}
+
+// Candidate is an interceptor that did not match a request.
+type Candidate struct {
+	Interceptor *Interceptor `json:"-"`
+	Description string       `json:"description"`
+	// Reasons lists every reason why the interceptor did not match.
+	Reasons []string `json:"reasons"`
+}
+
+func newNoMatchError(s *Scope, req *http.Request) *NoMatchError {
+	candidates := make([]Candidate, 0)
+	for _, scope := range s.root().scopes() {
+		for _, i := range scope.interceptors {
+			candidates = append(candidates, Candidate{
+				Interceptor: i,
+				Description: strings.TrimSuffix(i.String(), "\n"),
+				Reasons:     i.mismatches(req),
+			})
+		}
+	}
+	return &NoMatchError{
+		Request:    req,
+		Method:     req.Method,
+		URL:        strings.TrimPrefix(describeRequest(req), req.Method+" "),
+		Strategy:   s.root().strategy,
+		Candidates: candidates,
+		Suggestion: suggestUsage(s, req),
+	}
+}
+
+func (e *NoMatchError) Error() string {
+	return fmt.Sprintf("Gnock found no match for request: %s %s\n\nMatch strategy: %s\n\nRegistered interceptors:\n%s\nDid you forget to add the interceptor?\n%s", e.Method, e.URL, e.Strategy, e.describeCandidates(), e.Suggestion)
+}
+
+func (e *NoMatchError) describeCandidates() string {
+	result := ""
+	for _, candidate := range e.Candidates {
+		result += candidate.Description + "\n"
+		for _, reason := range candidate.Reasons {
+			result += "\tno match: " + reason + "\n"
+		}
+	}
+	if result == "" {
+		return "none\n"
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package gnock
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// requestSchemeAndHost returns the normalized scheme and host of the request
+// that host matchers compare against.
+func requestSchemeAndHost(req *http.Request) string {
+	return normalizeSchemeAndHost(req.URL.Scheme, req.URL.Host)
+}
+
+// normalizeSchemeAndHost lower cases the scheme and host, converts
+// internationalized domain names to punycode and removes default ports so
+// that e.g. "HTTP://Example.com:80" equals "http://example.com". Without a
+// scheme the result is scheme relative, e.g. "//example.com".
+func normalizeSchemeAndHost(scheme, host string) string {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" {
+		return "//" + normalizeHost(scheme, host)
+	}
+	return scheme + "://" + normalizeHost(scheme, host)
+}
+
+func normalizeHost(scheme, host string) string {
+	u := &url.URL{Host: host}
+	hostname, port := normalizeHostname(u.Hostname()), u.Port()
+	if strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	}
+	if port != "" && port != defaultPorts[scheme] {
+		hostname += ":" + port
+	}
+	return hostname
+}
+
+// splitSchemeAndHost splits a normalized scheme and host, the scheme is empty
+// for scheme relative hosts.
+func splitSchemeAndHost(schemeAndHost string) (string, string) {
+	index := strings.Index(schemeAndHost, "//")
+	return strings.TrimSuffix(schemeAndHost[:index], ":"), schemeAndHost[index+2:]
+}
+
+// describeSchemeAndHost describes scheme relative hosts as matching any scheme.
+func describeSchemeAndHost(schemeAndHost string) string {
+	if strings.HasPrefix(schemeAndHost, "//") {
+		return "*:" + schemeAndHost
+	}
+	return schemeAndHost
+}
+
+func normalizeHostname(hostname string) string {
+	hostname = strings.ToLower(hostname)
+	ascii, err := idna.ToASCII(hostname)
+	if err != nil {
+		return hostname
+	}
+	return ascii
+}
+
+// escapePath returns the escaped form of a path given to an interceptor. A
+// path that already contains valid escapes, e.g. "/a%2Fb", is kept as is.
+func escapePath(path string) string {
+	if strings.Contains(path, "%") {
+		if _, err := url.PathUnescape(path); err == nil {
+			return normalizeEscapes(path)
+		}
+	}
+	return normalizeEscapes((&url.URL{Path: path}).EscapedPath())
+}
+
+// requestPath returns the normalized escaped path of the request which,
+// unlike URL.Path, keeps encoded slashes and similar apart.
+func requestPath(req *http.Request) string {
+	return normalizeEscapes(req.URL.EscapedPath())
+}
+
+// normalizeURL returns the normalized scheme, host, escaped path and query of
+// the URL so that equivalent URLs compare equal.
+func normalizeURL(u *url.URL) string {
+	path := normalizeEscapes(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	result := normalizeSchemeAndHost(u.Scheme, u.Host) + path
+	if u.RawQuery != "" {
+		result += "?" + u.Query().Encode()
+	}
+	return result
+}
+
+// normalizeEscapes decodes escaped unreserved characters and upper cases the
+// remaining escapes as recommended by RFC 3986.
+func normalizeEscapes(path string) string {
+	var result strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) && isHex(path[i+1]) && isHex(path[i+2]) {
+			c := unhex(path[i+1])<<4 | unhex(path[i+2])
+			if isUnreserved(c) {
+				result.WriteByte(c)
+			} else {
+				result.WriteString("%" + strings.ToUpper(path[i+1:i+3]))
+			}
+			i += 2
+			continue
+		}
+		result.WriteByte(path[i])
+	}
+	return result.String()
+}
+
+func toggleTrailingSlash(path string) string {
+	if path == "/" || path == "" {
+		return path
+	}
+	if strings.HasSuffix(path, "/") {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path + "/"
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) != -1
+}
@@ -0,0 +1,199 @@
+package gnock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data available to the templates of
+// Interceptor.ReplyTemplate.
+type TemplateData struct {
+	Method string
+	Path   string
+	// Params holds the values captured by the path template of the
+	// interceptor, e.g. {{.Params.id}}.
+	Params Params
+	Query  url.Values
+	Header http.Header
+	// Body is the decoded JSON request body, e.g. {{.Body.name}}, or the body
+	// as a string if it is not JSON.
+	Body interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		buf, err := json.Marshal(value)
+		return string(buf), err
+	},
+}
+
+func mustParseReplyTemplate(text string) *template.Template {
+	return template.Must(template.New("reply").Funcs(templateFuncs).Option("missingkey=error").Parse(text))
+}
+
+func newTemplateData(req *http.Request, params Params) TemplateData {
+	body := readBody(req)
+	var decoded interface{} = string(body)
+	if value, err := decodeJSON(body); err == nil {
+		decoded = value
+	}
+	return TemplateData{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Params: params,
+		Query:  req.URL.Query(),
+		Header: req.Header,
+		Body:   decoded,
+	}
+}
+
+// renderTemplate executes the template into a response.
+func renderTemplate(req *http.Request, status int, tmpl *template.Template, data TemplateData) (*http.Response, error) {
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return newResponse(req, status, body.String(), nil), nil
+}
+
+// newResponse builds a response populated the same way as one read from the
+// network by net/http.
+func newResponse(req *http.Request, status int, body string, header http.Header) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	res := &http.Response{
+		Request:       req,
+		Status:        statusLine(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: int64(len(body)),
+	}
+	if body != "" {
+		res.Body = ioutil.NopCloser(bytes.NewBufferString(body))
+	}
+	return res
+}
+
+// normalizeResponse fills in the fields that a custom Responder left out so
+// that every response looks like one from a real transport.
+func normalizeResponse(req *http.Request, res *http.Response) *http.Response {
+	res.Request = req
+	if res.StatusCode == 0 {
+		res.StatusCode = http.StatusOK
+	}
+	if res.Status == "" {
+		res.Status = statusLine(res.StatusCode)
+	}
+	if res.Proto == "" {
+		res.Proto, res.ProtoMajor, res.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	if res.Header == nil {
+		res.Header = make(http.Header)
+	}
+	if res.Body == nil {
+		res.Body = http.NoBody
+		res.ContentLength = 0
+	} else if res.ContentLength == 0 && res.Body != http.NoBody {
+		// A zero length would tell clients that there is no body to read
+		res.ContentLength = -1
+	}
+	return res
+}
+
+// newFileResponse streams the file as the response body.
+func newFileResponse(req *http.Request, status int, path string) (*http.Response, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	res := newResponse(req, status, "", http.Header{"Content-Type": []string{contentTypeByExtension(path)}})
+	res.Body = file
+	res.ContentLength = info.Size()
+	return res, nil
+}
+
+func contentTypeByExtension(path string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// withTrailer announces the trailer in the response and fills in its values
+// once the body has been read to the end, like a chunked response would.
+func withTrailer(res *http.Response, trailer http.Header) *http.Response {
+	if len(trailer) == 0 {
+		return res
+	}
+	if res.Trailer == nil {
+		res.Trailer = make(http.Header)
+	}
+	for name := range trailer {
+		if _, ok := res.Trailer[name]; !ok {
+			res.Trailer[name] = nil
+		}
+	}
+	res.TransferEncoding = []string{"chunked"}
+	res.ContentLength = -1
+	res.Body = &trailerBody{ReadCloser: res.Body, res: res, trailer: trailer}
+	return res
+}
+
+type trailerBody struct {
+	io.ReadCloser
+	res     *http.Response
+	trailer http.Header
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		for name, values := range b.trailer {
+			if len(b.res.Trailer[name]) == 0 {
+				b.res.Trailer[name] = append([]string(nil), values...)
+			}
+		}
+	}
+	return n, err
+}
+
+func statusLine(status int) string {
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+// bufferRequest returns a shallow copy of the request with the body read into
+// memory and closes the original body, as required by http.RoundTripper, so
+// that matchers and responders can read the body any number of times.
+func bufferRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	buffered := *req
+	buffered.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return &buffered, nil
+}
@@ -4,64 +4,139 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"testing"
+	"time"
 )
 
 type Scope struct {
 	parent         *Scope
-	child          *Scope
-	host           string
-	hostRegexp     *regexp.Regexp
+	children       []*Scope
+	hostMatcher    Matcher
+	regexpHost     bool
+	hosts          []string
+	basePath       string
+	ignoreTrailing bool
+	headFromGet    bool
+	unmatched      UnmatchedPolicy
 	interceptors   []*Interceptor
+	matchers       []Matcher
 	defaultHeaders http.Header
+	headerDelay    time.Duration
+	bodyDelay      time.Duration
+	// the fields below are only kept by the root scope
+	mu              sync.Mutex // guards received and the use of interceptors
+	received        []ReceivedRequest
+	strategy        MatchStrategy
+	clock           Clock
+	t               testing.TB
+	replacedDefault bool
 }
 
 // Make sure Scope conforms to the RoundTripper interface and can be used as a Transport
 var _ http.RoundTripper = (*Scope)(nil)
 
 func NewScope(parent *Scope, host string) *Scope {
-	parsed, err := url.Parse(host)
-	if err != nil {
-		panic(err.Error())
+	return NewHostsScope(parent, []string{host})
+}
+
+// NewHostsScope creates a scope matching any of the given hosts, which must
+// all have the same base path.
+func NewHostsScope(parent *Scope, hosts []string) *Scope {
+	if len(hosts) == 0 {
+		panic("at least one host is required")
 	}
-	if parsed.Path != "" {
-		panic(fmt.Sprintf("host should only contain scheme, host and port not path, got: %q", host))
+
+	normalizedHosts := make([]string, 0, len(hosts))
+	matchers := make([]Matcher, 0, len(hosts))
+	basePath := ""
+	for index, host := range hosts {
+		schemeAndHost, path, matcher := parseHost(host)
+		if index > 0 && path != basePath {
+			panic(fmt.Sprintf("all hosts must have the same base path, got: %q", hosts))
+		}
+		normalizedHosts = append(normalizedHosts, schemeAndHost)
+		matchers = append(matchers, matcher)
+		basePath = path
 	}
 
-	return &Scope{
+	s := &Scope{
 		parent:         parent,
-		host:           host,
+		hostMatcher:    matchers[0],
+		hosts:          normalizedHosts,
 		interceptors:   make([]*Interceptor, 0),
 		defaultHeaders: make(http.Header, 0),
 	}
+	if len(matchers) > 1 {
+		s.hostMatcher = anyHostMatcher(matchers)
+	}
+	return s.BasePath(basePath)
+}
+
+// parseHost returns the normalized scheme and host, the base path and a
+// matcher for a host given to Gnock.
+func parseHost(host string) (string, string, Matcher) {
+	parsed, err := url.Parse(host)
+	if err != nil {
+		panic(err.Error())
+	}
+	if parsed.RawQuery != "" || parsed.ForceQuery || parsed.Fragment != "" {
+		panic(fmt.Sprintf("host should only contain scheme, host, port and base path not query or fragment, got: %q", host))
+	}
+	if parsed.Host == "" {
+		panic(fmt.Sprintf("host should contain a host, e.g. \"https://example.com\" or \"//example.com\" for any scheme, got: %q", host))
+	}
+
+	schemeAndHost := normalizeSchemeAndHost(parsed.Scheme, parsed.Host)
+	if isGlob(parsed.Host) {
+		return schemeAndHost, parsed.Path, hostGlobMatcher(schemeAndHost)
+	}
+	return schemeAndHost, parsed.Path, hostMatcher(schemeAndHost)
 }
 
 func NewRegexpScope(parent *Scope, hostRegexp *regexp.Regexp) *Scope {
 	return &Scope{
 		parent:         parent,
-		hostRegexp:     hostRegexp,
+		hostMatcher:    hostRegexpMatcher(hostRegexp),
+		regexpHost:     true,
 		interceptors:   make([]*Interceptor, 0),
 		defaultHeaders: make(http.Header, 0),
 	}
 }
 
 func (s *Scope) ReplaceDefault() *Scope {
-	if originalDefaultTransport != nil {
+	if originalDefaultTransport == nil {
 		originalDefaultTransport = http.DefaultTransport
 	}
 	http.DefaultTransport = s
+	s.root().replacedDefault = true
 	return s
 }
 
 func (s *Scope) Gnock(host string) *Scope {
-	s.child = NewScope(s, host)
-	return s.child
+	return s.addChild(NewScope(s, host))
+}
+
+func (s *Scope) GnockHosts(hosts ...string) *Scope {
+	return s.addChild(NewHostsScope(s, hosts))
 }
 
 func (s *Scope) GnockRegexp(host string) *Scope {
-	s.child = NewRegexpScope(s, regexp.MustCompile(host))
-	return s.child
+	return s.addChild(NewRegexpScope(s, regexp.MustCompile(host)))
+}
+
+// addChild attaches a scope to the hierarchy. Any number of child scopes can
+// be attached to the same scope, they are consulted in the order they were
+// added after the interceptors of the scope itself.
+func (s *Scope) addChild(child *Scope) *Scope {
+	s.children = append(s.children, child)
+	return child
 }
 
 func (s *Scope) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -70,30 +145,254 @@ func (s *Scope) RoundTrip(req *http.Request) (*http.Response, error) {
 		return s.parent.RoundTrip(req)
 	}
 
+	buffered, err := bufferRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	// Responders run without holding the lock as they may be delayed
+	res, err := s.receive(buffered)(buffered)
+	if res != nil {
+		// Responses refer to the request given to RoundTrip, not the copy
+		normalizeResponse(req, res)
+		if res.Header.Get("Date") == "" {
+			res.Header.Set("Date", s.clockOrDefault().Now().UTC().Format(http.TimeFormat))
+		}
+	}
+	return res, err
+}
+
+// receive records the request in the journal and returns how to respond to
+// it. The lock is released even if a matcher panics.
+func (s *Scope) receive(req *http.Request) Responder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, ReceivedRequest{Request: req, Time: s.clockOrDefault().Now()})
 	return s.roundTrip(req)
 }
 
-func (s *Scope) roundTrip(req *http.Request) (*http.Response, error) {
+// roundTrip uses the interceptor serving the request and returns how to
+// respond, which must be called with the lock of the root released.
+func (s *Scope) roundTrip(req *http.Request) Responder {
 	// ...and this method serves matched requests down the scope hierarchy.
-	for _, interceptor := range s.interceptors {
-		if interceptor.intercepts(req) {
-			return interceptor.respond(req)
+	if interceptor := s.findInterceptor((*Interceptor).intercepts, req); interceptor != nil {
+		interceptor.use(req)
+		return interceptor.respond
+	}
+
+	// HEAD requests are only served by GET interceptors when no interceptor
+	// matched the HEAD request itself.
+	if interceptor := s.findInterceptor((*Interceptor).interceptsHead, req); interceptor != nil {
+		interceptor.useHead(req)
+		return interceptor.respondHead
+	}
+
+	policy, noMatch := s.unmatchedPolicy(req), newNoMatchError(s, req)
+	return func(req *http.Request) (*http.Response, error) {
+		return policy(req, noMatch)
+	}
+}
+
+// unmatchedPolicy returns the policy of the scope closest to the request, or
+// of its closest parent having one, falling back to the global default.
+func (s *Scope) unmatchedPolicy(req *http.Request) UnmatchedPolicy {
+	scope := s.closestScope(req)
+	if scope == nil {
+		scope = s
+	}
+	for ; scope != nil; scope = scope.parent {
+		if scope.unmatched != nil {
+			return scope.unmatched
 		}
 	}
+	if root := s.root(); root.t != nil {
+		return reportOnUnmatched(root.t)
+	}
+	return defaultUnmatchedPolicy
+}
 
-	if s.child != nil {
-		return s.child.roundTrip(req)
+// OnUnmatched sets what happens to requests that no interceptor matches when
+// this scope is the closest to the request, by host and base path, or when it
+// is the closest parent of such a scope having a policy.
+func (s *Scope) OnUnmatched(policy UnmatchedPolicy) *Scope {
+	s.unmatched = policy
+	return s
+}
+
+// verify reports unused interceptors and restores the default transport when
+// a test using a root scope created by New has finished.
+func (s *Scope) verify() {
+	s.t.Helper()
+	if s.replacedDefault {
+		RestoreDefault()
+	}
+	if err := s.Err(); err != nil {
+		s.t.Errorf("%s", err)
 	}
+}
 
-	panic(fmt.Sprintf("Gnock found no match for request: %s\n\nRegistered interceptors:\n%s\n%s", describeRequest(req), describeInterceptors(s), describeUsage(req)))
+// findInterceptor returns the interceptor that intercepts the request and is
+// preferred by the match strategy or nil if no interceptor intercepts it.
+func (s *Scope) findInterceptor(intercepts func(*Interceptor, *http.Request) bool, req *http.Request) *Interceptor {
+	var found *Interceptor
+	for _, scope := range s.scopes() {
+		for _, interceptor := range scope.interceptors {
+			if intercepts(interceptor, req) && (found == nil || s.strategy.prefers(interceptor, found)) {
+				found = interceptor
+			}
+		}
+	}
+	return found
+}
+
+// MatchStrategy sets how the scope hierarchy picks among several interceptors
+// with the same priority that match a request.
+func (s *Scope) MatchStrategy(strategy MatchStrategy) *Scope {
+	s.root().strategy = strategy
+	return s
+}
+
+// Clock sets the source of time of the whole scope hierarchy, e.g. a
+// FakeClock. Interceptors already set to ExpireAfter a duration count it from
+// now on the new clock.
+func (s *Scope) Clock(clock Clock) *Scope {
+	root := s.root()
+	root.clock = clock
+	for _, scope := range root.scopes() {
+		for _, interceptor := range scope.interceptors {
+			if !interceptor.expires.IsZero() {
+				interceptor.startExpiry()
+			}
+		}
+	}
+	return s
+}
+
+func (s *Scope) clockOrDefault() Clock {
+	if root := s.root(); root.clock != nil {
+		return root.clock
+	}
+	return SystemClock
+}
+
+// Received returns the requests received by the whole scope hierarchy in the
+// order they were received, matched or not. It must not be called from a
+// Matcher, see Matcher.
+func (s *Scope) Received() []ReceivedRequest {
+	root := s.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return append([]ReceivedRequest(nil), root.received...)
 }
 
+// IsDone panics unless all interceptors in the whole scope hierarchy have
+// been used, see Err.
 func (s *Scope) IsDone() {
-	for _, interceptor := range s.interceptors {
-		if interceptor.times > 0 {
-			panic(fmt.Sprintf("Not all interceptors have been used! Found: %+v", interceptor))
+	if err := s.Err(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Err returns an error describing every unused interceptor in the whole scope
+// hierarchy or nil if all have been used.
+func (s *Scope) Err() error {
+	pending, description := s.describePending()
+	if len(pending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("not all interceptors have been used, pending interceptors:\n%s", description)
+}
+
+// Pending returns the interceptors in the whole scope hierarchy, not only in
+// the receiver, that have not been used as many times as expected, including
+// HEAD requests budgeted with HeadTimes. Expired interceptors are not pending
+// as they can no longer be used.
+func (s *Scope) Pending() []*Interceptor {
+	pending, _ := s.describePending()
+	return pending
+}
+
+// describePending returns the pending interceptors and their description,
+// which is built while holding the lock as requests in flight update what the
+// interceptors have captured.
+func (s *Scope) describePending() ([]*Interceptor, string) {
+	root := s.root()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	pending := make([]*Interceptor, 0)
+	for _, scope := range root.scopes() {
+		for _, interceptor := range scope.interceptors {
+			if interceptor.pending() {
+				pending = append(pending, interceptor)
+			}
+		}
+	}
+	return pending, describeInterceptorList(pending)
+}
+
+func (s *Scope) root() *Scope {
+	if s.parent != nil {
+		return s.parent.root()
+	}
+	return s
+}
+
+// BasePath makes the paths of all interceptors in the scope relative to the
+// given prefix, e.g. "/api/v2".
+func (s *Scope) BasePath(prefix string) *Scope {
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		panic(fmt.Sprintf("base path must start with /, got: %q", prefix))
+	}
+	s.basePath = strings.TrimRight(prefix, "/")
+	return s
+}
+
+// IgnoreTrailingSlash makes paths match regardless of whether they end with a
+// slash or not, e.g. "/widgets" matches "/widgets/" and vice versa.
+func (s *Scope) IgnoreTrailingSlash() *Scope {
+	s.ignoreTrailing = true
+	return s
+}
+
+// HeadFromGet makes GET interceptors in the scope also serve HEAD requests
+// that no other interceptor matches. The body is stripped from the response
+// while headers and Content-Length are kept. A HEAD request counts against the
+// Times of the GET interceptor unless it has a separate Interceptor.HeadTimes.
+func (s *Scope) HeadFromGet() *Scope {
+	s.headFromGet = true
+	return s
+}
+
+// ServeDir adds a GET interceptor for every file under dir, e.g. "testdata",
+// that replies with the file as ReplyFile does. A file is served at its path
+// relative to dir appended to prefix, so "testdata/users/1.json" is served at
+// "/api/users/1.json" for the prefix "/api". Like a file server the files may
+// be requested any number of times, including none, so they are never
+// pending.
+func (s *Scope) ServeDir(prefix, dir string) *Scope {
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		panic(fmt.Sprintf("prefix must start with /, got: %q", prefix))
+	}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
 		}
+		relative, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		filePath := path.Join("/", prefix, filepath.ToSlash(relative))
+		i := NewInterceptor(s, "GET", filePath)
+		// File names are taken literally rather than as globs or templates
+		i.pathMatcher = pathMatcher(filePath)
+		i.unlimited = true
+		s.interceptors = append(s.interceptors, i)
+		i.ReplyFile(http.StatusOK, file)
+		return nil
+	})
+	if err != nil {
+		panic(err.Error())
 	}
+	return s
 }
 
 func (s *Scope) DefaultReplyHeaders(headers http.Header) *Scope {
@@ -101,6 +400,50 @@ func (s *Scope) DefaultReplyHeaders(headers http.Header) *Scope {
 	return s
 }
 
+// Delay delays the response headers of all interceptors in the scope, see
+// Interceptor.DelayHeaders.
+func (s *Scope) Delay(d time.Duration) *Scope {
+	return s.DelayHeaders(d)
+}
+
+// DelayHeaders delays the response headers of all interceptors in the scope
+// that do not have a delay of their own, see Interceptor.DelayHeaders.
+func (s *Scope) DelayHeaders(d time.Duration) *Scope {
+	s.headerDelay = d
+	return s
+}
+
+// DelayBody delays the response bodies of all interceptors in the scope that
+// do not have a delay of their own, see Interceptor.DelayBody.
+func (s *Scope) DelayBody(d time.Duration) *Scope {
+	s.bodyDelay = d
+	return s
+}
+
+// MatchHeader requires every request intercepted by this scope to carry the
+// given header value, in addition to what each interceptor matches on.
+func (s *Scope) MatchHeader(name, value string) *Scope {
+	s.matchers = append(s.matchers, headerMatcher(name, value))
+	return s
+}
+
+func (s *Scope) MatchHeaderRegexp(name, pattern string) *Scope {
+	s.matchers = append(s.matchers, headerRegexpMatcher(name, regexp.MustCompile(pattern)))
+	return s
+}
+
+func (s *Scope) MatchHeaderAbsent(name string) *Scope {
+	s.matchers = append(s.matchers, headerAbsentMatcher(name))
+	return s
+}
+
+// Match requires every request intercepted by this scope to also match the
+// given matchers.
+func (s *Scope) Match(matchers ...Matcher) *Scope {
+	s.matchers = append(s.matchers, matchers...)
+	return s
+}
+
 func (s *Scope) Intercept(method, path string) *Interceptor {
 	i := NewInterceptor(s, method, path)
 	s.interceptors = append(s.interceptors, i)
@@ -113,6 +456,8 @@ func (s *Scope) Interceptf(method, pathTemplate string, args ...interface{}) *In
 	return i
 }
 
+// InterceptRegexp intercepts requests whose decoded path, e.g. "/a b" rather
+// than "/a%20b", matches the regexp.
 func (s *Scope) InterceptRegexp(method, path string) *Interceptor {
 	i := NewRegexpInterceptor(s, method, regexp.MustCompile(path))
 	s.interceptors = append(s.interceptors, i)
@@ -139,6 +484,22 @@ func (s *Scope) Delete(path string) *Interceptor {
 	return s.Intercept("DELETE", path)
 }
 
+func (s *Scope) Patch(path string) *Interceptor {
+	return s.Intercept("PATCH", path)
+}
+
+func (s *Scope) Head(path string) *Interceptor {
+	return s.Intercept("HEAD", path)
+}
+
+func (s *Scope) Connect(path string) *Interceptor {
+	return s.Intercept("CONNECT", path)
+}
+
+func (s *Scope) Trace(path string) *Interceptor {
+	return s.Intercept("TRACE", path)
+}
+
 func (s *Scope) Getf(pathTemplate string, args ...interface{}) *Interceptor {
 	return s.Interceptf("GET", pathTemplate, args...)
 }
@@ -159,6 +520,22 @@ func (s *Scope) Deletef(pathTemplate string, args ...interface{}) *Interceptor {
 	return s.Interceptf("DELETE", pathTemplate, args...)
 }
 
+func (s *Scope) Patchf(pathTemplate string, args ...interface{}) *Interceptor {
+	return s.Interceptf("PATCH", pathTemplate, args...)
+}
+
+func (s *Scope) Headf(pathTemplate string, args ...interface{}) *Interceptor {
+	return s.Interceptf("HEAD", pathTemplate, args...)
+}
+
+func (s *Scope) Connectf(pathTemplate string, args ...interface{}) *Interceptor {
+	return s.Interceptf("CONNECT", pathTemplate, args...)
+}
+
+func (s *Scope) Tracef(pathTemplate string, args ...interface{}) *Interceptor {
+	return s.Interceptf("TRACE", pathTemplate, args...)
+}
+
 func (s *Scope) GetRegexp(path string) *Interceptor {
 	return s.InterceptRegexp("GET", path)
 }
@@ -179,59 +556,233 @@ func (s *Scope) DeleteRegexp(path string) *Interceptor {
 	return s.InterceptRegexp("DELETE", path)
 }
 
-func (s *Scope) String() string {
-	if s.hostRegexp != nil {
-		return s.hostRegexp.String()
+func (s *Scope) PatchRegexp(path string) *Interceptor {
+	return s.InterceptRegexp("PATCH", path)
+}
+
+func (s *Scope) HeadRegexp(path string) *Interceptor {
+	return s.InterceptRegexp("HEAD", path)
+}
+
+func (s *Scope) ConnectRegexp(path string) *Interceptor {
+	return s.InterceptRegexp("CONNECT", path)
+}
+
+func (s *Scope) TraceRegexp(path string) *Interceptor {
+	return s.InterceptRegexp("TRACE", path)
+}
+
+// Any intercepts requests to the path using any HTTP method.
+func (s *Scope) Any(path string) *Interceptor {
+	return s.Methods(nil, path)
+}
+
+// Methods intercepts requests to the path using any of the given HTTP
+// methods, which are upper cased. A nil slice matches any method while an
+// empty one panics as it would never match.
+func (s *Scope) Methods(methods []string, path string) *Interceptor {
+	if methods != nil && len(methods) == 0 {
+		panic("methods must not be empty, use nil or Any to match any method")
+	}
+	i := NewInterceptor(s, "", path)
+	i.methods = nil
+	for _, method := range methods {
+		i.methods = append(i.methods, strings.ToUpper(method))
 	}
-	return s.host
+	s.interceptors = append(s.interceptors, i)
+	return i
+}
+
+func (s *Scope) String() string {
+	return describeMatcher(s.hostMatcher) + s.basePath
 }
 
 func (s *Scope) intercepts(req *http.Request) bool {
-	schemeAndHost := req.URL.Scheme + "://" + req.URL.Host
-	if s.hostRegexp != nil {
-		return s.hostRegexp.MatchString(schemeAndHost)
+	return s.mismatch(req) == ""
+}
+
+func (s *Scope) mismatch(req *http.Request) string {
+	return firstMismatch(s.allMatchers(), req)
+}
+
+// relativePath returns the path relative to the base path of the scope and
+// whether the path is within the base path at all.
+func (s *Scope) relativePath(path string) (string, bool) {
+	if path != s.basePath && !strings.HasPrefix(path, s.basePath+"/") {
+		return "", false
 	}
-	return s.host == schemeAndHost
+	relative := strings.TrimPrefix(path, s.basePath)
+	if relative == "" {
+		return "/", true
+	}
+	return relative, true
 }
 
-func describeRequest(req *http.Request) string {
-	return fmt.Sprintf("%s %s", req.Method, req.URL.String())
+// scopedPathMatcher applies the path matcher to the path relative to the base
+// path of the scope, optionally ignoring trailing slashes.
+func (s *Scope) scopedPathMatcher(m Matcher) Matcher {
+	if s.basePath == "" && !s.ignoreTrailing {
+		return m
+	}
+	return MatcherFunc(func(req *http.Request) (bool, string) {
+		relative, ok := s.relativeRequest(req)
+		if !ok {
+			return false, fmt.Sprintf("path: expected to start with %s, got %s", s.basePath, requestPath(req))
+		}
+		ok, reason := m.Match(relative)
+		if !ok && s.ignoreTrailing {
+			if toggled, _ := m.Match(withPath(relative, toggleTrailingSlash(relative.URL.Path), toggleTrailingSlash(relative.URL.RawPath))); toggled {
+				return true, ""
+			}
+		}
+		return ok, reason
+	})
 }
 
-func describeInterceptors(s *Scope) string {
-	result := ""
-	if s.parent != nil {
-		result = describeInterceptors(s.parent)
+// relativeRequest returns a shallow copy of the request with the path made
+// relative to the base path of the scope.
+func (s *Scope) relativeRequest(req *http.Request) (*http.Request, bool) {
+	relative, ok := s.relativePath(req.URL.Path)
+	if !ok {
+		return nil, false
+	}
+	rawRelative := ""
+	if req.URL.RawPath != "" {
+		rawRelative, _ = s.relativePath(req.URL.RawPath)
+	}
+	return withPath(req, relative, rawRelative), true
+}
+
+// scopes returns the scope hierarchy starting at the receiver, depth first
+// with each scope before its children.
+func (s *Scope) scopes() []*Scope {
+	scopes := []*Scope{s}
+	for _, child := range s.children {
+		scopes = append(scopes, child.scopes()...)
+	}
+	return scopes
+}
+
+// closestScope returns the scope with the longest base path whose host and
+// base path match the request or nil if there is none.
+func (s *Scope) closestScope(req *http.Request) *Scope {
+	var closest *Scope
+	for _, scope := range s.root().scopes() {
+		if ok, _ := scope.hostMatcher.Match(req); !ok {
+			continue
+		}
+		if _, ok := scope.relativePath(req.URL.Path); !ok {
+			continue
+		}
+		if closest == nil || len(scope.basePath) > len(closest.basePath) {
+			closest = scope
+		}
 	}
-	for _, i := range s.interceptors {
-		result += i.String()
+	return closest
+}
+
+func (s *Scope) describeUsage() string {
+	if s.regexpHost {
+		usage := fmt.Sprintf("gnock.GnockRegexp(%q)", describeMatcher(s.hostMatcher))
+		if s.basePath != "" {
+			usage += fmt.Sprintf(".\n\tBasePath(\"%s\")", s.basePath)
+		}
+		return usage
 	}
-	if result == "" {
-		return "none\n"
+	if len(s.hosts) > 1 {
+		hosts := make([]string, 0, len(s.hosts))
+		for _, host := range s.hosts {
+			hosts = append(hosts, fmt.Sprintf(`"%s"`, host+s.basePath))
+		}
+		return fmt.Sprintf("gnock.GnockHosts(%s)", strings.Join(hosts, ", "))
 	}
-	return result
+	return fmt.Sprintf(`gnock.Gnock("%s")`, s.hosts[0]+s.basePath)
 }
 
-var existingHTTPMethodFuncs = map[string]bool{
-	"Get":     true,
-	"Post":    true,
-	"Put":     true,
-	"Options": true,
-	"Delete":  true,
+func (s *Scope) allMatchers() []Matcher {
+	return append([]Matcher{s.hostMatcher}, s.matchers...)
 }
 
-func describeUsage(req *http.Request) string {
-	schemeAndHost := req.URL.Scheme + "://" + req.URL.Host
-	httpMethodFunc := strings.Title(strings.ToLower(req.Method))
-	interceptorParams := fmt.Sprintf(`"%s"`, req.URL.Path)
+func describeRequest(req *http.Request) string {
+	description := fmt.Sprintf("%s %s%s", req.Method, requestSchemeAndHost(req), requestPath(req))
+	if req.URL.RawQuery != "" {
+		description += "?" + req.URL.RawQuery
+	}
+	return description
+}
+
+// httpMethodHelpers lists the HTTP methods that have Scope helpers named
+// after them, e.g. Get, Getf and GetRegexp for GET.
+var httpMethodHelpers = []struct {
+	method string
+	helper string
+}{
+	{"GET", "Get"},
+	{"HEAD", "Head"},
+	{"POST", "Post"},
+	{"PUT", "Put"},
+	{"PATCH", "Patch"},
+	{"DELETE", "Delete"},
+	{"CONNECT", "Connect"},
+	{"OPTIONS", "Options"},
+	{"TRACE", "Trace"},
+}
+
+var existingHTTPMethodFuncs = func() map[string]string {
+	funcs := make(map[string]string, len(httpMethodHelpers))
+	for _, h := range httpMethodHelpers {
+		funcs[h.method] = h.helper
+	}
+	return funcs
+}()
+
+// suggestUsage returns Go code adding an interceptor for the request.
+func suggestUsage(s *Scope, req *http.Request) string {
+	scopeUsage := fmt.Sprintf(`gnock.Gnock("%s")`, requestSchemeAndHost(req))
+	path := requestPath(req)
+	if closest := s.closestScope(req); closest != nil {
+		scopeUsage = closest.describeUsage()
+		path, _ = closest.relativePath(path)
+	}
+
+	httpMethodFunc, ok := existingHTTPMethodFuncs[req.Method]
+	interceptorParams := fmt.Sprintf(`"%s"`, path)
 
-	if !existingHTTPMethodFuncs[httpMethodFunc] {
+	if !ok {
 		httpMethodFunc = "Intercept"
-		interceptorParams = fmt.Sprintf(`"%s", "%s"`, req.Method, req.URL.Path)
+		interceptorParams = fmt.Sprintf(`"%s", "%s"`, req.Method, path)
 	}
 
-	return fmt.Sprintf(`Did you forget to add the interceptor?
-gnock.Gnock("%s").
-	%s(%s).
-	Reply(200, "OK")`, schemeAndHost, httpMethodFunc, interceptorParams)
+	return fmt.Sprintf(`%s.
+	%s(%s).%s
+	Reply(200, "OK")`, scopeUsage, httpMethodFunc, interceptorParams, describeQueryUsage(req.URL.Query()))
+}
+
+func withPath(req *http.Request, path, rawPath string) *http.Request {
+	clone := *req
+	u := *req.URL
+	u.Path = path
+	u.RawPath = rawPath
+	clone.URL = &u
+	return &clone
+}
+
+func describeQueryUsage(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := make([]string, 0, len(query[key]))
+		for _, value := range query[key] {
+			values = append(values, fmt.Sprintf("%q", value))
+		}
+		params = append(params, fmt.Sprintf("%q: {%s}", key, strings.Join(values, ", ")))
+	}
+	return fmt.Sprintf("\n\tQuery(url.Values{%s}).", strings.Join(params, ", "))
 }
@@ -0,0 +1,93 @@
+package gnock
+
+// MatchStrategy decides which interceptor serves a request when several
+// interceptors with the same priority match it.
+type MatchStrategy int
+
+const (
+	// FirstMatch picks the interceptor registered first, parent scopes
+	// before child scopes and sibling scopes in the order they were added.
+	// This is the default.
+	FirstMatch MatchStrategy = iota
+	// MostSpecific picks the interceptor with the most specific host, then
+	// path and method, then the one with the most additional matchers. An
+	// exact host or path is more specific than a template, which is more
+	// specific than a glob, which is more specific than a regexp.
+	MostSpecific
+)
+
+func (strategy MatchStrategy) String() string {
+	switch strategy {
+	case MostSpecific:
+		return "most specific"
+	default:
+		return "first match"
+	}
+}
+
+func (strategy MatchStrategy) MarshalText() ([]byte, error) {
+	return []byte(strategy.String()), nil
+}
+
+// Specificity ranks of host and path matchers, custom matchers rank lowest.
+const (
+	regexpSpecificity = iota
+	globSpecificity
+	templateSpecificity
+	exactSpecificity
+)
+
+// prefers returns whether candidate should serve a request instead of the
+// current interceptor which was registered earlier.
+func (strategy MatchStrategy) prefers(candidate, current *Interceptor) bool {
+	if candidate.priority != current.priority {
+		return candidate.priority > current.priority
+	}
+	if strategy != MostSpecific {
+		return false
+	}
+	candidateSpecificity, currentSpecificity := candidate.specificity(), current.specificity()
+	for index := range candidateSpecificity {
+		if candidateSpecificity[index] != currentSpecificity[index] {
+			return candidateSpecificity[index] > currentSpecificity[index]
+		}
+	}
+	return false
+}
+
+// specificity returns the ranks of the host, path, method and the number of
+// additional matchers of the interceptor, in order of importance.
+func (i *Interceptor) specificity() []int {
+	methodSpecificity := 0
+	if i.methods != nil {
+		// Fewer methods are more specific but any list beats any method
+		methodSpecificity = len(httpMethodHelpers) + 1 - len(i.methods)
+	}
+	return []int{
+		matcherSpecificity(i.scope.hostMatcher),
+		matcherSpecificity(i.pathMatcher),
+		methodSpecificity,
+		len(i.scope.matchers) + len(i.matchers),
+	}
+}
+
+func matcherSpecificity(m Matcher) int {
+	switch m := m.(type) {
+	case requestMatcher:
+		return m.specificity
+	case *pathTemplate:
+		return templateSpecificity
+	default:
+		return regexpSpecificity
+	}
+}
+
+func minSpecificity(matchers []Matcher) int {
+	min := exactSpecificity
+	for _, m := range matchers {
+		if specificity := matcherSpecificity(m); specificity < min {
+			min = specificity
+		}
+	}
+	return min
+}
@@ -0,0 +1,137 @@
+package gnock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Params holds the values captured by a path template such as
+// "/widgets/{id:int}".
+type Params map[string]string
+
+// Int returns the named parameter converted to an int. It panics if the
+// parameter is not an integer. That can not happen for parameters captured
+// with the int type as a path only matches when they fit in an int.
+func (p Params) Int(name string) int {
+	value, err := strconv.Atoi(p[name])
+	if err != nil {
+		panic(fmt.Sprintf("path parameter %q is not an int: %q", name, p[name]))
+	}
+	return value
+}
+
+func (p Params) String() string {
+	return describeParams(p)
+}
+
+// ParamsResponder is a Responder that also receives the parameters captured
+// by the path template of the interceptor.
+type ParamsResponder func(req *http.Request, params Params) (*http.Response, error)
+
+var pathTemplateTypes = map[string]string{
+	"string": `[^/]+`,
+	"int":    `-?[0-9]+`,
+}
+
+type pathTemplate struct {
+	template string
+	names    []string
+	types    []string
+	regexp   *regexp.Regexp
+}
+
+func isPathTemplate(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+func mustParsePathTemplate(template string) *pathTemplate {
+	t := &pathTemplate{template: template}
+	pattern := "^"
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start == -1 {
+			pattern += regexp.QuoteMeta(escapePath(rest))
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			panic(fmt.Sprintf("unterminated parameter in path template %q", template))
+		}
+		pattern += regexp.QuoteMeta(escapePath(rest[:start]))
+		name, typ := rest[start+1:start+end], "string"
+		if colon := strings.Index(name, ":"); colon != -1 {
+			name, typ = name[:colon], name[colon+1:]
+		}
+		typePattern, ok := pathTemplateTypes[typ]
+		if !ok {
+			panic(fmt.Sprintf("unknown parameter type %q in path template %q", typ, template))
+		}
+		if name == "" || strings.ContainsAny(name, "{/") {
+			panic(fmt.Sprintf("invalid parameter name %q in path template %q", name, template))
+		}
+		if containsString(t.names, name) {
+			panic(fmt.Sprintf("duplicate parameter %q in path template %q", name, template))
+		}
+		t.names = append(t.names, name)
+		t.types = append(t.types, typ)
+		pattern += "(" + typePattern + ")"
+		rest = rest[start+end+1:]
+	}
+	t.regexp = regexp.MustCompile(pattern + "$")
+	return t
+}
+
+func (t *pathTemplate) Match(req *http.Request) (bool, string) {
+	actual := requestPath(req)
+	if _, ok := t.params(actual); !ok {
+		return false, fmt.Sprintf("path: expected %s, got %s", t.template, actual)
+	}
+	return true, ""
+}
+
+// params matches the escaped path, see requestPath, so that an encoded slash
+// is captured as part of a parameter. The captured values are unescaped.
+func (t *pathTemplate) params(path string) (Params, bool) {
+	submatches := t.regexp.FindStringSubmatch(path)
+	if submatches == nil {
+		return nil, false
+	}
+	params := make(Params, len(t.names))
+	for index, name := range t.names {
+		value, err := url.PathUnescape(submatches[index+1])
+		if err != nil {
+			value = submatches[index+1]
+		}
+		if t.types[index] == "int" {
+			// Values out of range for an int do not match
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, false
+			}
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+func (t *pathTemplate) String() string {
+	return t.template
+}
+
+func describeParams(params Params) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+params[key])
+	}
+	return strings.Join(parts, " ")
+}
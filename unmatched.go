@@ -0,0 +1,59 @@
+package gnock
+
+import (
+	"net/http"
+	"testing"
+)
+
+// UnmatchedPolicy decides what happens to a request that no interceptor
+// matches. It receives the request and an error describing why nothing
+// matched.
+type UnmatchedPolicy func(req *http.Request, err *NoMatchError) (*http.Response, error)
+
+var defaultUnmatchedPolicy UnmatchedPolicy = PanicOnUnmatched
+
+// SetDefaultUnmatchedPolicy sets the policy used by scopes that have no policy
+// of their own, see Scope.OnUnmatched. The initial default is
+// PanicOnUnmatched.
+func SetDefaultUnmatchedPolicy(policy UnmatchedPolicy) {
+	if policy == nil {
+		policy = PanicOnUnmatched
+	}
+	defaultUnmatchedPolicy = policy
+}
+
+// PanicOnUnmatched panics with a description of the request, the registered
+// interceptors and how to add the missing one.
+func PanicOnUnmatched(req *http.Request, err *NoMatchError) (*http.Response, error) {
+	panic(err.Error())
+}
+
+// ErrorOnUnmatched makes RoundTrip return the *NoMatchError.
+func ErrorOnUnmatched(req *http.Request, err *NoMatchError) (*http.Response, error) {
+	return nil, err
+}
+
+// RespondOnUnmatched responds with the given status, e.g. 501, and the
+// description of the *NoMatchError as body.
+func RespondOnUnmatched(status int) UnmatchedPolicy {
+	return func(req *http.Request, err *NoMatchError) (*http.Response, error) {
+		return newResponse(req, status, err.Error(), http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}}), nil
+	}
+}
+
+// PassthroughOnUnmatched sends the request using the given transport, e.g.
+// to let requests to a local test server through.
+func PassthroughOnUnmatched(transport http.RoundTripper) UnmatchedPolicy {
+	return func(req *http.Request, err *NoMatchError) (*http.Response, error) {
+		return transport.RoundTrip(req)
+	}
+}
+
+// reportOnUnmatched is the default policy of root scopes created by New since
+// panicking could crash a goroutine the test does not own.
+func reportOnUnmatched(t testing.TB) UnmatchedPolicy {
+	return func(req *http.Request, err *NoMatchError) (*http.Response, error) {
+		t.Errorf("%s", err)
+		return nil, err
+	}
+}